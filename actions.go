@@ -6,3 +6,12 @@ func (s *SpriteStack) register(actionID string, action func() error) {
 	}
 	s.actionHandler[actionID] = action
 }
+
+// registerDrag sets an action called while sprites with actionID are dragged, on top of the one called once the drag
+// is done.
+func (s *SpriteStack) registerDrag(actionID string, action func() error) {
+	if s.dragHandler == nil {
+		s.dragHandler = map[string]func() error{}
+	}
+	s.dragHandler[actionID] = action
+}
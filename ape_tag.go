@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// apeFooterSize is the size of the footer ending APE tags, also the size of the header starting APEv2 ones.
+const apeFooterSize = 32
+
+// apeMaxTagSize bounds what we read for tags that say they are bigger than is sane.
+const apeMaxTagSize = 1 << 24
+
+// APE item types, in bits 1 and 2 of the item flags.
+const (
+	apeItemText   = 0
+	apeItemBinary = 1
+)
+
+// readAPEv2 reads the APE tag at the end of r, which Monkey's Audio and WavPack files use and some MP3 taggers
+// write. It comes before the ID3v1 tag when there is one.
+func readAPEv2(r io.ReadSeeker) (TrackInfo, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return TrackInfo{}, err
+	}
+	footer := make([]byte, apeFooterSize)
+	found := false
+	for _, skip := range []int64{0, id3v1Size} {
+		if end-skip < apeFooterSize {
+			continue
+		}
+		if _, err := r.Seek(end-skip-apeFooterSize, io.SeekStart); err != nil {
+			return TrackInfo{}, err
+		}
+		if _, err := io.ReadFull(r, footer); err != nil {
+			return TrackInfo{}, err
+		}
+		if string(footer[:8]) == "APETAGEX" {
+			end -= skip
+			found = true
+			break
+		}
+	}
+	if !found {
+		return TrackInfo{}, errNoTags
+	}
+	// the size counts the items and the footer but not the header.
+	size := int64(binary.LittleEndian.Uint32(footer[12:]))
+	count := binary.LittleEndian.Uint32(footer[16:])
+	if size < apeFooterSize || size > apeMaxTagSize || size > end {
+		return TrackInfo{}, errors.New("broken APE tag")
+	}
+	items := make([]byte, size-apeFooterSize)
+	if _, err := r.Seek(end-size, io.SeekStart); err != nil {
+		return TrackInfo{}, err
+	}
+	if _, err := io.ReadFull(r, items); err != nil {
+		return TrackInfo{}, fmt.Errorf("reading APE tag: %w", err)
+	}
+	info := parseAPEItems(items, count)
+	if info.empty() {
+		return TrackInfo{}, errNoTags
+	}
+	return info, nil
+}
+
+// parseAPEItems reads count items, each being the size of its value, flags, a NUL terminated key and the value.
+// Keys are case insensitive.
+func parseAPEItems(items []byte, count uint32) TrackInfo {
+	var info TrackInfo
+	for i := uint32(0); i < count && len(items) >= 8; i++ {
+		size := binary.LittleEndian.Uint32(items)
+		flags := binary.LittleEndian.Uint32(items[4:])
+		items = items[8:]
+		keyEnd := bytes.IndexByte(items, 0)
+		if keyEnd < 0 || uint64(size) > uint64(len(items)-keyEnd-1) {
+			// a broken item ends the tag, what came before it is fine.
+			break
+		}
+		key := strings.ToLower(string(items[:keyEnd]))
+		value := items[keyEnd+1 : keyEnd+1+int(size)]
+		items = items[keyEnd+1+int(size):]
+		switch (flags >> 1) & 3 {
+		case apeItemText:
+			// lists of values are separated by NULs, the first one will do.
+			text, _, _ := bytes.Cut(value, []byte{0})
+			info.setField(key, string(text))
+		case apeItemBinary:
+			if picture, ok := apePicture(key, value); ok {
+				info.Pictures = append(info.Pictures, picture)
+			}
+		}
+	}
+	return info
+}
+
+// apePicture decodes the "Cover Art (...)" items: the file name of the picture, a NUL and the image.
+func apePicture(key string, value []byte) (Picture, bool) {
+	kind, ok := strings.CutPrefix(key, "cover art (")
+	if !ok {
+		return Picture{}, false
+	}
+	name, data, ok := bytes.Cut(value, []byte{0})
+	if !ok || len(data) == 0 {
+		return Picture{}, false
+	}
+	picture := Picture{
+		Description: string(name),
+		Data:        data,
+	}
+	// ID3 picture types, "other" for the ones that aren't the cover.
+	switch strings.TrimSuffix(kind, ")") {
+	case "front":
+		picture.Type = pictureFrontCover
+	case "back":
+		picture.Type = 4
+	}
+	switch strings.ToLower(filepath.Ext(string(name))) {
+	case ".jpg", ".jpeg":
+		picture.MIMEType = "image/jpeg"
+	case ".png":
+		picture.MIMEType = "image/png"
+	case ".gif":
+		picture.MIMEType = "image/gif"
+	case ".bmp":
+		picture.MIMEType = "image/bmp"
+	}
+	return picture, true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// apeItem builds an item, binary ones hold pictures.
+func apeItem(key string, value []byte, isBinary bool) []byte {
+	var flags uint32
+	if isBinary {
+		flags = apeItemBinary << 1
+	}
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(value)))
+	b = binary.LittleEndian.AppendUint32(b, flags)
+	b = append(b, key...)
+	b = append(b, 0)
+	return append(b, value...)
+}
+
+// apeTag builds an APEv2 tag with only a footer, as most taggers write them.
+func apeTag(items ...[]byte) []byte {
+	b := bytes.Join(items, nil)
+	footer := []byte("APETAGEX")
+	footer = binary.LittleEndian.AppendUint32(footer, 2000)
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(b)+apeFooterSize))
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(items)))
+	footer = append(footer, make([]byte, 12)...)
+	return append(b, footer...)
+}
+
+func TestReadAPEv2(t *testing.T) {
+	cover := []byte("\xff\xd8 jpeg image")
+	tag := apeTag(
+		apeItem("Title", []byte("Title"), false),
+		apeItem("ARTIST", []byte("First\x00Second"), false),
+		apeItem("Track", []byte("3/12"), false),
+		apeItem("REPLAYGAIN_TRACK_GAIN", []byte("-3.2 dB"), false),
+		apeItem("Cover Art (Front)", append([]byte("cover.jpg\x00"), cover...), true))
+	want := TrackInfo{Title: "Title", Artist: "First", Track: 3,
+		ReplayGain: ReplayGain{TrackGain: -3.2, HasTrack: true},
+		Pictures: []Picture{{Type: pictureFrontCover, MIMEType: "image/jpeg", Description: "cover.jpg",
+			Data: cover}}}
+	audio := []byte("audio frames")
+	files := map[string][]byte{
+		"at the end":   append(append([]byte{}, audio...), tag...),
+		"before ID3v1": bytes.Join([][]byte{audio, tag, id3v1Tag("ID3v1 title", "", "", "", "", 0, 0)}, nil),
+		"only the tag": tag,
+	}
+	for name, file := range files {
+		info, err := readAPEv2(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%s: got %+v, want %+v", name, info, want)
+		}
+	}
+}
+
+func TestReadAPEv2Broken(t *testing.T) {
+	tag := apeTag(apeItem("Title", []byte("Title"), false))
+	// the footer says the tag is larger than the file.
+	tooLarge := append([]byte{}, tag...)
+	binary.LittleEndian.PutUint32(tooLarge[len(tooLarge)-apeFooterSize+12:], 1<<20)
+	if _, err := readAPEv2(bytes.NewReader(tooLarge)); err == nil {
+		t.Error("read a tag larger than its file")
+	}
+	for name, data := range map[string][]byte{
+		"empty":    nil,
+		"short":    []byte("APETAGEX"),
+		"no tag":   bytes.Repeat([]byte("audio"), 100),
+		"no items": apeTag(),
+	} {
+		if _, err := readAPEv2(bytes.NewReader(data)); !errors.Is(err, errNoTags) {
+			t.Errorf("%s: got error %v, want %v", name, err, errNoTags)
+		}
+	}
+}
+
+func TestParseAPEItems(t *testing.T) {
+	title := apeItem("Title", []byte("Title"), false)
+	// an item saying its value is larger than the tag ends it, the items before it are kept.
+	broken := apeItem("Artist", []byte("Artist"), false)
+	binary.LittleEndian.PutUint32(broken, 1<<30)
+	items := bytes.Join([][]byte{title, broken, apeItem("Album", []byte("Album"), false)}, nil)
+	if info := parseAPEItems(items, 3); !reflect.DeepEqual(info, TrackInfo{Title: "Title"}) {
+		t.Errorf("got %+v, want only the title", info)
+	}
+	// the count says how many items to read, even when more follow.
+	items = bytes.Join([][]byte{title, apeItem("Album", []byte("Album"), false)}, nil)
+	if info := parseAPEItems(items, 1); info.Album != "" {
+		t.Errorf("read past the count: %+v", info)
+	}
+	// reading every prefix of the items shouldn't panic.
+	items = bytes.Join([][]byte{title, apeItem("Cover Art (Back)", []byte("back.png\x00image"), true)}, nil)
+	for n := range items {
+		parseAPEItems(items[:n], 2)
+	}
+}
+
+// TestReadAPEv2Truncated reads tags cut anywhere, with the footer still at the end of the file, none should panic.
+func TestReadAPEv2Truncated(t *testing.T) {
+	tag := apeTag(
+		apeItem("Title", []byte("Title"), false),
+		apeItem("Cover Art (Front)", []byte("front.gif\x00image"), true))
+	items, footer := tag[:len(tag)-apeFooterSize], tag[len(tag)-apeFooterSize:]
+	for n := range items {
+		readAPEv2(bytes.NewReader(append(append([]byte{}, items[n:]...), footer...)))
+		readAPEv2(bytes.NewReader(append(append([]byte{}, items[:n]...), footer...)))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+// balancer pans the stereo PCM of its source, as Winamp does: the side the balance leans to stays as it is and the
+// other one is turned down, to silence at the ends.
+type balancer struct {
+	src io.ReadSeeker
+	mu  sync.Mutex
+	// balance goes from -1, only the left side, to 1, only the right one.
+	balance float64
+}
+
+func newBalancer(src io.ReadSeeker) *balancer {
+	return &balancer{src: src}
+}
+
+func (b *balancer) Balance() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.balance
+}
+
+// SetBalance sets the balance, it is clamped to [-1, 1].
+func (b *balancer) SetBalance(balance float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.balance = math.Max(-1, math.Min(1, balance))
+}
+
+func (b *balancer) Read(p []byte) (int, error) {
+	n, err := b.src.Read(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.balance == 0 {
+		return n, err
+	}
+	gains := [outputChannels]float64{math.Min(1, 1-b.balance), math.Min(1, 1+b.balance)}
+	for off := 0; off+bytesPerSample <= n; off += bytesPerSample {
+		v := float64(int16(binary.LittleEndian.Uint16(p[off:]))) * gains[off/bytesPerSample%outputChannels]
+		binary.LittleEndian.PutUint16(p[off:], uint16(clampSample(v)))
+	}
+	return n, err
+}
+
+func (b *balancer) Seek(offset int64, whence int) (int64, error) {
+	return b.src.Seek(offset, whence)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// CrossfadeCurve is how the volumes of the song fading out and the one fading in change during a crossfade.
+type CrossfadeCurve int
+
+const (
+	// CrossfadeLinear changes the volumes linearly, the overlap sounds quieter in the middle.
+	CrossfadeLinear CrossfadeCurve = iota
+	// CrossfadeEqualPower keeps the loudness constant for songs that aren't correlated, which is usually the case.
+	CrossfadeEqualPower
+)
+
+func (c CrossfadeCurve) String() string {
+	if c == CrossfadeEqualPower {
+		return "equal-power"
+	}
+	return "linear"
+}
+
+// Set parses the names returned by String, so the curve can be a flag.
+func (c *CrossfadeCurve) Set(name string) error {
+	switch name {
+	case "linear":
+		*c = CrossfadeLinear
+	case "equal-power":
+		*c = CrossfadeEqualPower
+	default:
+		return fmt.Errorf("unknown crossfade curve %q, expected linear or equal-power", name)
+	}
+	return nil
+}
+
+// gains returns the volume of the song fading in and the one fading out at x, which goes from 0 to 1 along the
+// crossfade.
+func (c CrossfadeCurve) gains(x float64) (in, out float64) {
+	if x > 1 {
+		x = 1
+	}
+	if c == CrossfadeEqualPower {
+		return math.Sin(x * math.Pi / 2), math.Cos(x * math.Pi / 2)
+	}
+	return x, 1 - x
+}
+
+// setCrossfade sets how long songs overlap, 0 splices them one after the other.
+func (s *stream) setCrossfade(d time.Duration, curve CrossfadeCurve) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d < 0 {
+		d = 0
+	}
+	s.crossfade = int64(d.Seconds()*sampleRate) * outputFrameSize
+	s.curve = curve
+}
+
+func (s *stream) crossfadeSettings() (time.Duration, CrossfadeCurve) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return framesDuration(s.crossfade/outputFrameSize, sampleRate), s.curve
+}
+
+// crossfadeTo makes t the current track mixing it with the one that was, it reports false if crossfading is off
+// or there is nothing to fade from, in which case the stream is left alone.
+func (s *stream) crossfadeTo(t *track) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.crossfade == 0 || s.current == nil || s.ended {
+		return false, nil
+	}
+	err := s.dropNextLocked()
+	s.enter(t)
+	s.next = t
+	if fErr := s.startFade(s.crossfade); err == nil {
+		err = fErr
+	}
+	return true, err
+}
+
+// untilFade returns how many bytes of the current track are left before the next one starts fading in, which is when
+// what's left of it is as long as the crossfade, or -1 if there won't be a crossfade. Tracks of unknown length are
+// spliced.
+func (s *stream) untilFade() int64 {
+	if s.crossfade == 0 || s.next == nil || s.fadeOut != nil || s.current.length <= 0 {
+		return -1
+	}
+	until := s.currentSize() - s.current.pos - s.crossfade
+	if until < 0 {
+		return 0
+	}
+	return until
+}
+
+// currentSize is the size of the PCM of the current track, as told by its length.
+func (s *stream) currentSize() int64 {
+	return int64(s.current.length.Seconds()*sampleRate) * outputFrameSize
+}
+
+// startFade moves the current track to fadeOut and makes next current, the two are mixed over length bytes.
+func (s *stream) startFade(length int64) error {
+	err := s.stopFade()
+	s.fadeOut = s.current
+	s.current = s.next
+	s.current.startAt = s.read
+	s.next = nil
+	s.fadePos = 0
+	s.fadeLen = length
+	return err
+}
+
+// stopFade closes the track fading out, if any.
+func (s *stream) stopFade() error {
+	if s.fadeOut == nil {
+		return nil
+	}
+	err := s.fadeOut.Close()
+	s.fadeOut = nil
+	return err
+}
+
+// mix adds the track fading out to p, which holds PCM of the current track, applying the crossfade curve.
+func (s *stream) mix(p []byte) error {
+	if cap(s.fadeBuf) < len(p) {
+		s.fadeBuf = make([]byte, len(p))
+	}
+	out := s.fadeBuf[:len(p)]
+	n, err := io.ReadFull(s.fadeOut.source, out)
+	s.fadeOut.pos += int64(n)
+	clear(out[n:])
+	for off := 0; off+bytesPerSample <= len(p); off += bytesPerSample {
+		// both sides of a frame get the same gain
+		at := s.fadePos + int64(off/outputFrameSize*outputFrameSize)
+		in, fading := s.curve.gains(float64(at) / float64(s.fadeLen))
+		v := float64(int16(binary.LittleEndian.Uint16(p[off:])))*in +
+			float64(int16(binary.LittleEndian.Uint16(out[off:])))*fading
+		binary.LittleEndian.PutUint16(p[off:], uint16(clampSample(v)))
+	}
+	s.fadePos += int64(len(p))
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || s.fadePos >= s.fadeLen {
+		return s.stopFade()
+	}
+	if err != nil {
+		s.stopFade()
+		return err
+	}
+	return nil
+}
+
+// clampSample rounds v to the closest 16bit sample.
+func clampSample(v float64) int16 {
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(math.Round(v))
+}
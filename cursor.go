@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"time"
+
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// CursorFrame is one image of a cursor, HotX and HotY are the pixel that points.
+type CursorFrame struct {
+	Image      image.Image
+	HotX, HotY int
+}
+
+// SkinCursor is a cursor from the .cur and .ani files of a skin, animated ones have a frame per step with how long
+// it is shown.
+type SkinCursor struct {
+	Frames []CursorFrame
+	Rates  []time.Duration
+}
+
+// Image shows the first frame, fyne only asks for the cursor when the pointer moves so it can't be animated.
+func (c *SkinCursor) Image() (image.Image, int, int) {
+	return c.Frames[0].Image, c.Frames[0].HotX, c.Frames[0].HotY
+}
+
+var _ desktop.Cursor = (*SkinCursor)(nil)
+
+var errNotCursor = errors.New("not a cursor")
+
+// loadCursor reads a .cur or .ani file of the skin, they are told apart by their content as skins mix them up.
+func loadCursor(skin *Skin, name string) (*SkinCursor, error) {
+	f, err := skin.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading cursor %s: %w", name, err)
+	}
+	var cursor *SkinCursor
+	if bytes.HasPrefix(data, []byte("RIFF")) {
+		cursor, err = decodeANI(data)
+	} else {
+		var frame CursorFrame
+		frame, err = decodeCUR(data)
+		cursor = &SkinCursor{Frames: []CursorFrame{frame}}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding cursor %s: %w", name, err)
+	}
+	return cursor, nil
+}
+
+// decodeCUR decodes a .cur file, or an .ico one which has no hotspot. Files with several sizes give the largest.
+func decodeCUR(data []byte) (CursorFrame, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint16(data) != 0 {
+		return CursorFrame{}, errNotCursor
+	}
+	kind := binary.LittleEndian.Uint16(data[2:])
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if (kind != 1 && kind != 2) || count == 0 || len(data) < 6+16*count {
+		return CursorFrame{}, errNotCursor
+	}
+	best, bestSize := -1, -1
+	for i := 0; i < count; i++ {
+		entry := data[6+16*i:]
+		// 0 stands for 256.
+		width, height := int(entry[0]), int(entry[1])
+		if width == 0 {
+			width = 256
+		}
+		if height == 0 {
+			height = 256
+		}
+		if width*height > bestSize {
+			best, bestSize = i, width*height
+		}
+	}
+	entry := data[6+16*best:]
+	size := binary.LittleEndian.Uint32(entry[8:])
+	offset := binary.LittleEndian.Uint32(entry[12:])
+	if uint64(offset)+uint64(size) > uint64(len(data)) {
+		return CursorFrame{}, io.ErrUnexpectedEOF
+	}
+	img, err := decodeIconImage(data[offset : offset+size])
+	if err != nil {
+		return CursorFrame{}, err
+	}
+	frame := CursorFrame{Image: img}
+	if kind == 2 {
+		frame.HotX = int(binary.LittleEndian.Uint16(entry[4:]))
+		frame.HotY = int(binary.LittleEndian.Uint16(entry[6:]))
+	}
+	return frame, nil
+}
+
+// decodeIconImage decodes the image of an icon or cursor, either a PNG or a headerless BMP twice as tall as the
+// image: the colors followed by a 1 bit mask where set bits are transparent.
+func decodeIconImage(data []byte) (image.Image, error) {
+	if bytes.HasPrefix(data, []byte("\x89PNG")) {
+		return png.Decode(bytes.NewReader(data))
+	}
+	if len(data) < 40 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bitCount := int(binary.LittleEndian.Uint16(data[14:]))
+	compression := binary.LittleEndian.Uint32(data[16:])
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:]))
+	if headerSize < 40 || width <= 0 || height <= 0 || width > 256 || height > 256 || compression != 0 {
+		return nil, fmt.Errorf("unsupported cursor bitmap")
+	}
+	switch bitCount {
+	case 1, 4, 8, 24, 32:
+	default:
+		return nil, fmt.Errorf("unsupported cursor bit count %d", bitCount)
+	}
+	var palette []color.RGBA
+	if bitCount <= 8 {
+		if colorsUsed == 0 {
+			colorsUsed = 1 << bitCount
+		}
+		table := data[min(headerSize, len(data)):]
+		if len(table) < 4*colorsUsed {
+			return nil, io.ErrUnexpectedEOF
+		}
+		for i := 0; i < colorsUsed; i++ {
+			// stored as BGR plus a reserved byte.
+			palette = append(palette, color.RGBA{R: table[4*i+2], G: table[4*i+1], B: table[4*i], A: 0xff})
+		}
+	}
+	if headerSize+4*len(palette) > len(data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	pixels := data[headerSize+4*len(palette):]
+	stride := (width*bitCount + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if len(pixels) < stride*height {
+		return nil, io.ErrUnexpectedEOF
+	}
+	mask := pixels[stride*height:]
+	hasMask := len(mask) >= maskStride*height
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		// rows go from the bottom up.
+		row := pixels[(height-1-y)*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch bitCount {
+			case 32:
+				c = color.NRGBA{R: row[4*x+2], G: row[4*x+1], B: row[4*x], A: row[4*x+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{R: row[3*x+2], G: row[3*x+1], B: row[3*x], A: 0xff}
+			default:
+				bit := x * bitCount
+				index := int(row[bit/8]>>(8-bitCount-bit%8)) & (1<<bitCount - 1)
+				if index < len(palette) {
+					p := palette[index]
+					c = color.NRGBA{R: p.R, G: p.G, B: p.B, A: 0xff}
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	// 32 bit images carry their own transparency, unless they left it empty and rely on the mask like the rest.
+	if bitCount == 32 && hasAlpha || !hasMask {
+		return img, nil
+	}
+	for y := 0; y < height; y++ {
+		row := mask[(height-1-y)*maskStride:]
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(x, y)
+			if row[x/8]&(0x80>>(x%8)) != 0 {
+				img.Pix[i+3] = 0
+			} else {
+				img.Pix[i+3] = 0xff
+			}
+		}
+	}
+	return img, nil
+}
+
+// decodeANI decodes an animated cursor, a RIFF file with the frames as .cur files. The optional "seq " chunk orders
+// them into steps and "rate" says how long each step lasts.
+func decodeANI(data []byte) (*SkinCursor, error) {
+	if len(data) < 12 || string(data[8:12]) != "ACON" {
+		return nil, errNotCursor
+	}
+	var frames []CursorFrame
+	var rates, sequence []uint32
+	var defaultRate uint32
+	var walk func(chunks []byte) error
+	walk = func(chunks []byte) error {
+		for len(chunks) >= 8 {
+			id := string(chunks[:4])
+			size := int(binary.LittleEndian.Uint32(chunks[4:]))
+			if size > len(chunks)-8 {
+				return io.ErrUnexpectedEOF
+			}
+			body := chunks[8 : 8+size]
+			switch id {
+			case "anih":
+				if len(body) >= 32 {
+					defaultRate = binary.LittleEndian.Uint32(body[28:])
+				}
+			case "rate", "seq ":
+				values := make([]uint32, len(body)/4)
+				for i := range values {
+					values[i] = binary.LittleEndian.Uint32(body[4*i:])
+				}
+				if id == "rate" {
+					rates = values
+				} else {
+					sequence = values
+				}
+			case "LIST":
+				if len(body) >= 4 && string(body[:4]) == "fram" {
+					if err := walk(body[4:]); err != nil {
+						return err
+					}
+				}
+			case "icon":
+				frame, err := decodeCUR(body)
+				if err != nil {
+					return err
+				}
+				frames = append(frames, frame)
+			}
+			// chunks are padded to an even size.
+			chunks = chunks[min(len(chunks), 8+size+size%2):]
+		}
+		return nil
+	}
+	if err := walk(data[12:]); err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("animated cursor without frames")
+	}
+	if sequence == nil {
+		for i := range frames {
+			sequence = append(sequence, uint32(i))
+		}
+	}
+	cursor := &SkinCursor{}
+	for step, frame := range sequence {
+		if int(frame) >= len(frames) {
+			continue
+		}
+		rate := defaultRate
+		if step < len(rates) {
+			rate = rates[step]
+		}
+		cursor.Frames = append(cursor.Frames, frames[frame])
+		// rates are in jiffies, sixtieths of a second.
+		cursor.Rates = append(cursor.Rates, time.Duration(rate)*time.Second/60)
+	}
+	if len(cursor.Frames) == 0 {
+		return nil, errors.New("animated cursor without frames")
+	}
+	return cursor, nil
+}
+
+// windowCursors are the cursors of a window, picked by the sprite under the pointer.
+type windowCursors struct {
+	normal   desktop.Cursor
+	bySprite map[string]desktop.Cursor
+}
+
+// loadWindowCursors loads the cursors of a window, normal is the file used where no sprite has one and bySprite the
+// file of each sprite ID. Cursors the skin lacks or that can't be decoded are the system one.
+func loadWindowCursors(skin *Skin, normal string, bySprite map[string]string) *windowCursors {
+	loaded := map[string]desktop.Cursor{}
+	load := func(name string) desktop.Cursor {
+		if cursor, ok := loaded[name]; ok {
+			return cursor
+		}
+		var cursor desktop.Cursor = desktop.DefaultCursor
+		if c, err := loadCursor(skin, name); err == nil {
+			cursor = c
+		} else if !errors.Is(err, os.ErrNotExist) {
+			fmt.Println(err)
+		}
+		loaded[name] = cursor
+		return cursor
+	}
+	cursors := &windowCursors{normal: load(normal), bySprite: map[string]desktop.Cursor{}}
+	for id, name := range bySprite {
+		cursors.bySprite[id] = load(name)
+	}
+	return cursors
+}
+
+// at returns the cursor for x, y: the one of the topmost sprite there that has one.
+func (c *windowCursors) at(stack *SpriteStack, x, y int) desktop.Cursor {
+	for i := len(stack.sprites) - 1; i >= 0; i-- {
+		sp := stack.sprites[i]
+		if cursor, ok := c.bySprite[sp.ID]; ok && sp.Collision(x, y) {
+			return cursor
+		}
+	}
+	return c.normal
+}
+
+// mainCursors, eqCursors and playlistCursors are the cursor files Winamp uses for the sprites of each window.
+var mainCursors = map[string]string{
+	"wa.titlebar":              "titlebar.cur",
+	"wa.close":                 "close.cur",
+	"Close":                    "close.cur",
+	"wa.minimize":              "min.cur",
+	"Minimize":                 "min.cur",
+	"wa.sysmenu":               "mainmenu.cur",
+	"sysbutton":                "mainmenu.cur",
+	"wa.switch":                "winbut.cur",
+	"posbarbg":                 "posbar.cur",
+	"player.slider.seek":       "posbar.cur",
+	"player.slider.volume.bg":  "volbal.cur",
+	"player.slider.volume":     "volbal.cur",
+	"player.slider.balance.bg": "volbal.cur",
+	"player.slider.balance":    "volbal.cur",
+}
+
+var eqCursors = func() map[string]string {
+	cursors := map[string]string{
+		"eq.titlebar":  "eqtitle.cur",
+		"eq.close":     "eqclose.cur",
+		"eq.preamp":    "eqslid.cur",
+		"eq.preamp.bg": "eqslid.cur",
+	}
+	for band := 0; band < eqBandCount; band++ {
+		cursors[fmt.Sprintf("eq.band.%d", band)] = "eqslid.cur"
+		cursors[fmt.Sprintf("eq.band.%d.bg", band)] = "eqslid.cur"
+	}
+	return cursors
+}()
+
+var playlistCursors = map[string]string{
+	"pl.top.tile":   "ptbar.cur",
+	"pl.top.left":   "ptbar.cur",
+	"pl.top.right":  "ptbar.cur",
+	"pl.titlebar":   "ptbar.cur",
+	"pl.close":      "pclose.cur",
+	"pl.right.tile": "pvscroll.cur",
+	"pl.scroll":     "pvscroll.cur",
+}
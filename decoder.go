@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Decoder is an audio stream decoded into interleaved signed 16bit little endian PCM, which is what the oto context
+// consumes. Seek offsets are bytes of that PCM, not of the file.
+type Decoder interface {
+	io.ReadSeeker
+	// SampleRate is the amount of frames per second of the decoded stream.
+	SampleRate() int
+	// ChannelCount is the amount of interleaved channels in each frame.
+	ChannelCount() int
+	// Duration is the total length of the stream, 0 if it can't be known.
+	Duration() time.Duration
+}
+
+// bytesPerSample is the size of one sample of one channel in the PCM yielded by a Decoder.
+const bytesPerSample = 2
+
+var errUnsupportedFormat = errors.New("unsupported audio format")
+
+// decoderFormat describes how to recognize and open one of the audio formats we can play.
+type decoderFormat struct {
+	name       string
+	extensions []string
+	// magic reports whether the first bytes of a file belong to this format.
+	magic func(header []byte) bool
+	open  func(r io.ReadSeeker) (Decoder, error)
+	// channels tells how many channels the file has from its first bytes, for formats whose decoder always yields
+	// the same amount. nil if the decoder's ChannelCount says it.
+	channels func(header []byte) int
+}
+
+// magicSize is the amount of bytes peeked from the beginning of a file to find out its format.
+const magicSize = 12
+
+var decoderFormats []*decoderFormat
+
+// registerDecoder adds a format to the ones newDecoder can open, formats register themselves on init.
+func registerDecoder(format *decoderFormat) {
+	decoderFormats = append(decoderFormats, format)
+}
+
+// supportedExtensions returns the extensions, dot included, of every registered format.
+func supportedExtensions() []string {
+	var extensions []string
+	for _, format := range decoderFormats {
+		extensions = append(extensions, format.extensions...)
+	}
+	return extensions
+}
+
+func (f *decoderFormat) hasExtension(ext string) bool {
+	for _, e := range f.extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// formatFor picks the format for a file, the magic bytes are trusted over the extension but a format that matches both
+// is preferred.
+func formatFor(name string, header []byte) (*decoderFormat, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, format := range decoderFormats {
+		if format.hasExtension(ext) && format.magic(header) {
+			return format, nil
+		}
+	}
+	for _, format := range decoderFormats {
+		if format.magic(header) {
+			return format, nil
+		}
+	}
+	for _, format := range decoderFormats {
+		if format.hasExtension(ext) {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", errUnsupportedFormat, filepath.Base(name))
+}
+
+// id3v2HeaderSize is the size of the ID3v2 tag header and footer.
+const id3v2HeaderSize = 10
+
+// readMagic returns the first bytes of the audio in r, ID3v2 tags are skipped because they can be prepended to
+// files of any format (the decoders know to skip them).
+func readMagic(r io.ReadSeeker) ([]byte, error) {
+	header := make([]byte, magicSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	header = header[:n]
+	if size, ok := id3v2TagSize(header); ok {
+		if _, err := r.Seek(size-int64(n), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		return readMagic(r)
+	}
+	return header, nil
+}
+
+// id3v2TagSize returns the full size of the ID3v2 tag that header starts with, if any.
+func id3v2TagSize(header []byte) (int64, bool) {
+	if len(header) < id3v2HeaderSize || string(header[:3]) != "ID3" {
+		return 0, false
+	}
+	// The tag size is a 28bit syncsafe integer that excludes header and footer.
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	size += id3v2HeaderSize
+	if header[5]&0x10 != 0 {
+		size += id3v2HeaderSize
+	}
+	return size, true
+}
+
+// newDecoder returns a Decoder for the audio in r, name is only used for its extension. It also tells about the
+// stream it decodes.
+func newDecoder(name string, r io.ReadSeeker) (*meteredDecoder, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("finding size: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewinding: %w", err)
+	}
+	header, err := readMagic(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewinding after header: %w", err)
+	}
+	format, err := formatFor(name, header)
+	if err != nil {
+		return nil, err
+	}
+	in := &countingReader{ReadSeeker: r}
+	d, err := format.open(in)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s stream: %w", format.name, err)
+	}
+	channels := d.ChannelCount()
+	if format.channels != nil {
+		channels = format.channels(header)
+	}
+	return newMeteredDecoder(d, in, channels, size), nil
+}
+
+// framesDuration converts an amount of frames at a given rate into time.
+func framesDuration(frames int64, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(frames) * time.Second / time.Duration(sampleRate)
+}
+
+// resolveSeek turns the arguments of a Seek over PCM into the absolute frame it points to.
+func resolveSeek(offset int64, whence int, current int64, frameSize int, totalFrames int64) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = current + offset
+	case io.SeekEnd:
+		abs = totalFrames*int64(frameSize) + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position %d", abs)
+	}
+	return abs / int64(frameSize), nil
+}
+
+// trimmedDecoder plays only part of a Decoder, it hides the silence encoders add before and after the audio.
+type trimmedDecoder struct {
+	Decoder
+	// start is the first frame of the audio in Decoder and frames how many of them there are.
+	start, frames int64
+	frameSize     int
+	pos           int64
+}
+
+func newTrimmedDecoder(d Decoder, start, frames int64) (Decoder, error) {
+	t := &trimmedDecoder{
+		Decoder:   d,
+		start:     start,
+		frames:    frames,
+		frameSize: d.ChannelCount() * bytesPerSample,
+	}
+	if _, err := t.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *trimmedDecoder) Read(p []byte) (int, error) {
+	left := t.frames*int64(t.frameSize) - t.pos
+	if left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := t.Decoder.Read(p)
+	t.pos += int64(n)
+	return n, err
+}
+
+func (t *trimmedDecoder) Seek(offset int64, whence int) (int64, error) {
+	frame, err := resolveSeek(offset, whence, t.pos, t.frameSize, t.frames)
+	if err != nil {
+		return 0, err
+	}
+	if frame > t.frames {
+		frame = t.frames
+	}
+	if _, err := t.Decoder.Seek((t.start+frame)*int64(t.frameSize), io.SeekStart); err != nil {
+		return 0, err
+	}
+	t.pos = frame * int64(t.frameSize)
+	return t.pos, nil
+}
+
+func (t *trimmedDecoder) Duration() time.Duration {
+	return framesDuration(t.frames, t.SampleRate())
+}
+
+// pcmBuffer holds PCM that was decoded in bigger chunks than what the reader asked for.
+type pcmBuffer struct {
+	data []byte
+	off  int
+	// pos is the amount of bytes handed out since the beginning of the stream.
+	pos int64
+}
+
+// read copies pending PCM into p, calling fill to decode more when there is none left.
+func (b *pcmBuffer) read(p []byte, fill func() error) (int, error) {
+	for b.off >= len(b.data) {
+		b.data = b.data[:0]
+		b.off = 0
+		if err := fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, b.data[b.off:])
+	b.off += n
+	b.pos += int64(n)
+	return n, nil
+}
+
+// seekTo drops the pending PCM, the next read will come from the given stream position.
+func (b *pcmBuffer) seekTo(pos int64) {
+	b.data = b.data[:0]
+	b.off = 0
+	b.pos = pos
+}
+
+func (b *pcmBuffer) appendSample(v int16) {
+	b.data = append(b.data, byte(v), byte(v>>8))
+}
+
+// appendScaled stores a sample of the given bit depth as 16bit.
+func (b *pcmBuffer) appendScaled(v int32, bits int) {
+	switch {
+	case bits > 16:
+		v >>= bits - 16
+	case bits < 16:
+		v <<= 16 - bits
+	}
+	b.appendSample(int16(v))
+}
+
+// appendFloat stores a sample in the [-1, 1] range as 16bit, clipping anything outside.
+func (b *pcmBuffer) appendFloat(v float64) {
+	switch {
+	case v > 1:
+		v = 1
+	case v < -1:
+		v = -1
+	}
+	b.appendSample(int16(v * 32767))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/mewkiz/flac"
+)
+
+type flacDecoder struct {
+	// r is what the stream reads, kept to start it over.
+	r      io.ReadSeeker
+	stream *flac.Stream
+	pcm    pcmBuffer
+}
+
+func isFLAC(header []byte) bool {
+	return len(header) >= 4 && string(header[:4]) == "fLaC"
+}
+
+func openFLAC(r io.ReadSeeker) (Decoder, error) {
+	stream, err := flac.NewSeek(r)
+	if err != nil {
+		return nil, err
+	}
+	return &flacDecoder{r: r, stream: stream}, nil
+}
+
+func (d *flacDecoder) SampleRate() int {
+	return int(d.stream.Info.SampleRate)
+}
+
+func (d *flacDecoder) ChannelCount() int {
+	return int(d.stream.Info.NChannels)
+}
+
+func (d *flacDecoder) Duration() time.Duration {
+	return framesDuration(int64(d.stream.Info.NSamples), d.SampleRate())
+}
+
+func (d *flacDecoder) Seek(offset int64, whence int) (int64, error) {
+	frameSize := d.ChannelCount() * bytesPerSample
+	total := int64(d.stream.Info.NSamples)
+	frame, err := resolveSeek(offset, whence, d.pcm.pos, frameSize, total)
+	if err != nil {
+		return 0, err
+	}
+	if total > 0 && frame >= total {
+		frame = total - 1
+	}
+	if frame == 0 {
+		return 0, d.rewind()
+	}
+	// the stream can only land at the beginning of a flac frame, the one holding our sample.
+	start, err := d.stream.Seek(uint64(frame))
+	if err != nil {
+		return 0, err
+	}
+	d.pcm.seekTo(frame * int64(frameSize))
+	if skip := int(frame-int64(start)) * frameSize; skip > 0 {
+		if err := d.fill(); err != nil {
+			return 0, err
+		}
+		d.pcm.off = skip
+	}
+	return d.pcm.pos, nil
+}
+
+// rewind goes back to the beginning. Streams without a seek table decode the whole file to seek anywhere, the
+// beginning is found by reading the headers again.
+func (d *flacDecoder) rewind() error {
+	if d.pcm.pos == 0 {
+		return nil
+	}
+	if _, err := d.r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	stream, err := flac.NewSeek(d.r)
+	if err != nil {
+		return err
+	}
+	d.stream = stream
+	d.pcm.seekTo(0)
+	return nil
+}
+
+func (d *flacDecoder) Read(p []byte) (int, error) {
+	return d.pcm.read(p, d.fill)
+}
+
+func (d *flacDecoder) fill() error {
+	frame, err := d.stream.ParseNext()
+	if err != nil {
+		return err
+	}
+	bits := int(d.stream.Info.BitsPerSample)
+	for i := 0; i < int(frame.BlockSize); i++ {
+		for _, subframe := range frame.Subframes {
+			d.pcm.appendScaled(subframe.Samples[i], bits)
+		}
+	}
+	return nil
+}
+
+func init() {
+	registerDecoder(&decoderFormat{
+		name:       "flac",
+		extensions: []string{".flac"},
+		magic:      isFLAC,
+		open:       openFLAC,
+	})
+}
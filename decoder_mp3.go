@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// go-mp3 always decodes to 16bit stereo
+const mp3Channels = 2
+const mp3FrameSize = mp3Channels * bytesPerSample
+
+// mp3DecoderDelay is the delay of the MPEG layer III decoder, the encoder delay LAME stores doesn't include it.
+const mp3DecoderDelay = 529
+
+// mp3InfoSize is enough of the first frame to hold the Xing/Info header and the LAME extension.
+const mp3InfoSize = 192
+
+type mp3Decoder struct {
+	*mp3.Decoder
+}
+
+func (d *mp3Decoder) ChannelCount() int {
+	return mp3Channels
+}
+
+func (d *mp3Decoder) Duration() time.Duration {
+	return framesDuration(d.Length()/mp3FrameSize, d.SampleRate())
+}
+
+func isMP3(header []byte) bool {
+	// MPEG audio frame sync, 11 bits set.
+	return len(header) >= 2 && header[0] == 0xff && header[1]&0xe0 == 0xe0
+}
+
+// mp3FileChannels tells if the first frame is mono, by its channel mode.
+func mp3FileChannels(header []byte) int {
+	if len(header) >= 4 && header[3]>>6 == 0x3 {
+		return 1
+	}
+	return 2
+}
+
+// mp3Gapless reads the Xing/Info frame encoders put before the audio, it returns which frames of the decoded PCM are
+// the actual song. ok is false when the stream doesn't say.
+//
+// The Info frame itself decodes to silence, then come the encoder and decoder delays, and the last frame is padded
+// to its full size. LAME and ffmpeg store the delay and padding right after the Xing header.
+func mp3Gapless(r io.ReadSeeker) (start, frames int64, ok bool, err error) {
+	var frame []byte
+	for {
+		frame = make([]byte, mp3InfoSize)
+		n, err := io.ReadFull(r, frame)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, 0, false, err
+		}
+		frame = frame[:n]
+		size, isTag := id3v2TagSize(frame)
+		if !isTag {
+			break
+		}
+		if _, err := r.Seek(size-int64(n), io.SeekCurrent); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	if len(frame) < 4 || !isMP3(frame) {
+		return 0, 0, false, nil
+	}
+	version := frame[1] >> 3 & 0x3
+	mono := frame[3]>>6 == 0x3
+	samplesPerFrame := int64(1152)
+	// the Xing header goes after the side info, whose size depends on the version and channels.
+	offset := 4 + 32
+	switch {
+	case version == 0x3 && mono:
+		offset = 4 + 17
+	case version != 0x3 && mono:
+		offset = 4 + 9
+	case version != 0x3:
+		offset = 4 + 17
+	}
+	if version != 0x3 {
+		samplesPerFrame = 576
+	}
+	if len(frame) < offset+8 {
+		return 0, 0, false, nil
+	}
+	if id := string(frame[offset : offset+4]); id != "Xing" && id != "Info" {
+		return 0, 0, false, nil
+	}
+	flags := binary.BigEndian.Uint32(frame[offset+4:])
+	if flags&0x1 == 0 {
+		// without the frame count we don't know where the song ends.
+		return 0, 0, false, nil
+	}
+	frameCount := int64(binary.BigEndian.Uint32(frame[offset+8:]))
+	pos := offset + 12
+	// stream size, seek table and quality
+	for _, field := range []struct {
+		flag uint32
+		size int
+	}{{0x2, 4}, {0x4, 100}, {0x8, 4}} {
+		if flags&field.flag != 0 {
+			pos += field.size
+		}
+	}
+	start = samplesPerFrame
+	frames = frameCount * samplesPerFrame
+	if len(frame) >= pos+24 {
+		switch string(frame[pos : pos+4]) {
+		case "LAME", "Lavc", "Lavf":
+			delay := int64(frame[pos+21])<<4 | int64(frame[pos+22])>>4
+			padding := int64(frame[pos+22]&0xf)<<8 | int64(frame[pos+23])
+			start += delay + mp3DecoderDelay
+			frames -= delay + padding
+		}
+	}
+	return start, frames, frames > 0, nil
+}
+
+func openMP3(r io.ReadSeeker) (Decoder, error) {
+	start, frames, gapless, err := mp3Gapless(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	d, err := mp3.NewDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	decoded := &mp3Decoder{Decoder: d}
+	if !gapless {
+		return decoded, nil
+	}
+	// the padding may be shorter than the decoder delay, there is nothing to keep past the end anyway.
+	if total := d.Length() / mp3FrameSize; total > 0 && start+frames > total {
+		frames = total - start
+	}
+	if frames <= 0 {
+		return decoded, nil
+	}
+	return newTrimmedDecoder(decoded, start, frames)
+}
+
+func init() {
+	registerDecoder(&decoderFormat{
+		name:       "mp3",
+		extensions: []string{".mp3"},
+		magic:      isMP3,
+		open:       openMP3,
+		channels:   mp3FileChannels,
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"time"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// vorbisChunkFrames is how many frames are decoded at a time.
+const vorbisChunkFrames = 4096
+
+type vorbisDecoder struct {
+	reader  *oggvorbis.Reader
+	samples []float32
+	pcm     pcmBuffer
+}
+
+func isOgg(header []byte) bool {
+	return len(header) >= 4 && string(header[:4]) == "OggS"
+}
+
+func openVorbis(r io.ReadSeeker) (Decoder, error) {
+	reader, err := oggvorbis.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &vorbisDecoder{
+		reader:  reader,
+		samples: make([]float32, vorbisChunkFrames*reader.Channels()),
+	}, nil
+}
+
+func (d *vorbisDecoder) SampleRate() int {
+	return d.reader.SampleRate()
+}
+
+func (d *vorbisDecoder) ChannelCount() int {
+	return d.reader.Channels()
+}
+
+func (d *vorbisDecoder) Duration() time.Duration {
+	return framesDuration(d.reader.Length(), d.SampleRate())
+}
+
+func (d *vorbisDecoder) Seek(offset int64, whence int) (int64, error) {
+	frameSize := d.ChannelCount() * bytesPerSample
+	frame, err := resolveSeek(offset, whence, d.pcm.pos, frameSize, d.reader.Length())
+	if err != nil {
+		return 0, err
+	}
+	if err := d.reader.SetPosition(frame); err != nil {
+		return 0, err
+	}
+	d.pcm.seekTo(frame * int64(frameSize))
+	return d.pcm.pos, nil
+}
+
+func (d *vorbisDecoder) Read(p []byte) (int, error) {
+	return d.pcm.read(p, d.fill)
+}
+
+func (d *vorbisDecoder) fill() error {
+	n, err := d.reader.Read(d.samples)
+	for _, s := range d.samples[:n] {
+		d.pcm.appendFloat(float64(s))
+	}
+	if n > 0 {
+		return nil
+	}
+	return err
+}
+
+func init() {
+	registerDecoder(&decoderFormat{
+		name:       "ogg vorbis",
+		extensions: []string{".ogg", ".oga"},
+		magic:      isOgg,
+		open:       openVorbis,
+	})
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// wavChunkFrames is how many frames are converted at a time.
+const wavChunkFrames = 4096
+
+type wavDecoder struct {
+	src           io.ReadSeeker
+	r             io.Reader
+	dataStart     int64
+	format        uint16
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+	dataSize      int64
+	raw           []byte
+	pcm           pcmBuffer
+}
+
+func isWAV(header []byte) bool {
+	return len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE"
+}
+
+func openWAV(r io.ReadSeeker) (Decoder, error) {
+	riff := make([]byte, 12)
+	if _, err := io.ReadFull(r, riff); err != nil {
+		return nil, fmt.Errorf("reading riff header: %w", err)
+	}
+	if !isWAV(riff) {
+		return nil, errors.New("not a RIFF WAVE file")
+	}
+	d := &wavDecoder{}
+	gotFormat := false
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			return nil, fmt.Errorf("looking for data chunk: %w", err)
+		}
+		id := string(chunkHeader[:4])
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("fmt chunk too short: %d", size)
+			}
+			fmtChunk := make([]byte, size)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return nil, fmt.Errorf("reading fmt chunk: %w", err)
+			}
+			d.format = binary.LittleEndian.Uint16(fmtChunk[0:])
+			d.channels = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+			d.sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+			d.bitsPerSample = int(binary.LittleEndian.Uint16(fmtChunk[14:]))
+			// WAVE_FORMAT_EXTENSIBLE carries the actual format in the first two bytes of its sub format GUID.
+			if d.format == wavFormatExtensible && size >= 26 {
+				d.format = binary.LittleEndian.Uint16(fmtChunk[24:])
+			}
+			gotFormat = true
+		case "data":
+			if !gotFormat {
+				return nil, errors.New("data chunk found before fmt chunk")
+			}
+			if err := d.validate(); err != nil {
+				return nil, err
+			}
+			dataStart, err := r.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, fmt.Errorf("finding data chunk: %w", err)
+			}
+			d.src = r
+			d.dataStart = dataStart
+			d.dataSize = size
+			d.r = io.LimitReader(r, size)
+			return d, nil
+		default:
+			if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+				return nil, fmt.Errorf("skipping %q chunk: %w", id, err)
+			}
+		}
+		// chunks are word aligned
+		if size%2 == 1 {
+			if _, err := r.Seek(1, io.SeekCurrent); err != nil {
+				return nil, fmt.Errorf("skipping padding: %w", err)
+			}
+		}
+	}
+}
+
+func (d *wavDecoder) validate() error {
+	if d.channels < 1 || d.sampleRate < 1 {
+		return fmt.Errorf("invalid wav with %d channels at %dHz", d.channels, d.sampleRate)
+	}
+	switch d.format {
+	case wavFormatPCM:
+		if d.bitsPerSample%8 != 0 || d.bitsPerSample < 8 || d.bitsPerSample > 32 {
+			return fmt.Errorf("unsupported %d bits pcm", d.bitsPerSample)
+		}
+	case wavFormatFloat:
+		if d.bitsPerSample != 32 && d.bitsPerSample != 64 {
+			return fmt.Errorf("unsupported %d bits float", d.bitsPerSample)
+		}
+	default:
+		return fmt.Errorf("unsupported wav format %#x", d.format)
+	}
+	return nil
+}
+
+func (d *wavDecoder) frameSize() int {
+	return d.channels * d.bitsPerSample / 8
+}
+
+func (d *wavDecoder) SampleRate() int {
+	return d.sampleRate
+}
+
+func (d *wavDecoder) ChannelCount() int {
+	return d.channels
+}
+
+func (d *wavDecoder) totalFrames() int64 {
+	return d.dataSize / int64(d.frameSize())
+}
+
+func (d *wavDecoder) Duration() time.Duration {
+	return framesDuration(d.totalFrames(), d.sampleRate)
+}
+
+func (d *wavDecoder) Seek(offset int64, whence int) (int64, error) {
+	outFrameSize := d.channels * bytesPerSample
+	frame, err := resolveSeek(offset, whence, d.pcm.pos, outFrameSize, d.totalFrames())
+	if err != nil {
+		return 0, err
+	}
+	if frame > d.totalFrames() {
+		frame = d.totalFrames()
+	}
+	srcOffset := frame * int64(d.frameSize())
+	if _, err := d.src.Seek(d.dataStart+srcOffset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	d.r = io.LimitReader(d.src, d.dataSize-srcOffset)
+	d.pcm.seekTo(frame * int64(outFrameSize))
+	return d.pcm.pos, nil
+}
+
+func (d *wavDecoder) Read(p []byte) (int, error) {
+	return d.pcm.read(p, d.fill)
+}
+
+func (d *wavDecoder) fill() error {
+	frameSize := d.frameSize()
+	if d.raw == nil {
+		d.raw = make([]byte, wavChunkFrames*frameSize)
+	}
+	n, err := io.ReadFull(d.r, d.raw)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	// a truncated file can end in the middle of a frame
+	n -= n % frameSize
+	if n == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return err
+	}
+	sampleSize := d.bitsPerSample / 8
+	for i := 0; i < n; i += sampleSize {
+		s := d.raw[i : i+sampleSize]
+		switch {
+		case d.format == wavFormatFloat && sampleSize == 4:
+			d.pcm.appendFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(s))))
+		case d.format == wavFormatFloat:
+			d.pcm.appendFloat(math.Float64frombits(binary.LittleEndian.Uint64(s)))
+		case sampleSize == 1:
+			// 8 bit wav is the only unsigned one
+			d.pcm.appendScaled(int32(s[0])-128, 8)
+		case sampleSize == 2:
+			d.pcm.appendSample(int16(binary.LittleEndian.Uint16(s)))
+		case sampleSize == 3:
+			d.pcm.appendScaled(int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24)>>8, 24)
+		default:
+			d.pcm.appendScaled(int32(binary.LittleEndian.Uint32(s)), 32)
+		}
+	}
+	return nil
+}
+
+func init() {
+	registerDecoder(&decoderFormat{
+		name:       "wav",
+		extensions: []string{".wav", ".wave"},
+		magic:      isWAV,
+		open:       openWAV,
+	})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// EqPreset is a named set of equalizer gains, in dB.
+type EqPreset struct {
+	Name   string
+	Preamp float64
+	Bands  [eqBandCount]float64
+}
+
+// Apply sets the gains of eq to the ones of the preset.
+func (p EqPreset) Apply(eq *Equalizer) {
+	eq.SetPreamp(p.Preamp)
+	eq.SetBands(p.Bands)
+}
+
+// eqPresetOf returns the current gains of eq as a preset.
+func eqPresetOf(name string, eq *Equalizer) EqPreset {
+	return EqPreset{Name: name, Preamp: eq.Preamp(), Bands: eq.Bands()}
+}
+
+// eqfHeader starts both .eqf files and winamp.q1, the preset library, which only differ in how many presets they
+// hold.
+const eqfHeader = "Winamp EQ library file v1.1\x1a!--"
+
+// eqfNameSize is the space a name takes in the file, NUL terminated.
+const eqfNameSize = 257
+
+// eqfMaxLevel is the bottom of a slider in the file, 0 is the top.
+const eqfMaxLevel = 63
+
+var errNotEQF = errors.New("not a Winamp EQ file")
+
+// eqfGain converts a slider level as stored in the file to dB.
+func eqfGain(level byte) float64 {
+	return EqMaxGain - 2*EqMaxGain*float64(min(level, eqfMaxLevel))/eqfMaxLevel
+}
+
+// eqfLevel is the inverse of eqfGain.
+func eqfLevel(gain float64) byte {
+	return byte(math.Round((EqMaxGain - clampGain(gain)) * eqfMaxLevel / (2 * EqMaxGain)))
+}
+
+// readEQF reads the presets of an .eqf file or a winamp.q1 library. Each preset is its name followed by the level
+// of the ten bands and the preamp, one byte each.
+func readEQF(r io.Reader) ([]EqPreset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// the last bytes of the header differ between the files Winamp writes, but they are always there.
+	if len(data) < len(eqfHeader) || !bytes.HasPrefix(data, []byte(eqfHeader[:len(eqfHeader)-4])) {
+		return nil, errNotEQF
+	}
+	data = data[len(eqfHeader):]
+	var presets []EqPreset
+	for len(data) >= eqfNameSize+eqBandCount+1 {
+		name, _, _ := bytes.Cut(data[:eqfNameSize], []byte{0})
+		levels := data[eqfNameSize : eqfNameSize+eqBandCount+1]
+		preset := EqPreset{Name: string(name), Preamp: eqfGain(levels[eqBandCount])}
+		for band := range preset.Bands {
+			preset.Bands[band] = eqfGain(levels[band])
+		}
+		presets = append(presets, preset)
+		data = data[eqfNameSize+eqBandCount+1:]
+	}
+	return presets, nil
+}
+
+func writeEQF(w io.Writer, presets []EqPreset) error {
+	if _, err := io.WriteString(w, eqfHeader); err != nil {
+		return err
+	}
+	for _, preset := range presets {
+		entry := make([]byte, eqfNameSize, eqfNameSize+eqBandCount+1)
+		// names longer than the field lose their end, there has to be room for the NUL.
+		copy(entry[:eqfNameSize-1], preset.Name)
+		for _, gain := range preset.Bands {
+			entry = append(entry, eqfLevel(gain))
+		}
+		entry = append(entry, eqfLevel(preset.Preamp))
+		if _, err := w.Write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadEQFFile(path string) ([]EqPreset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening presets: %w", err)
+	}
+	defer f.Close()
+	presets, err := readEQF(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading presets %s: %w", filepath.Base(path), err)
+	}
+	return presets, nil
+}
+
+func saveEQFFile(path string, presets []EqPreset) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating presets: %w", err)
+	}
+	err = writeEQF(f, presets)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing presets %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// eqPresetFromLevels makes a preset out of levels as Winamp shows them, from 1 at the bottom of the slider to 64 at
+// the top.
+func eqPresetFromLevels(name string, preamp byte, bands [eqBandCount]byte) EqPreset {
+	preset := EqPreset{Name: name, Preamp: eqfGain(64 - preamp)}
+	for band, level := range bands {
+		preset.Bands[band] = eqfGain(64 - level)
+	}
+	return preset
+}
+
+// builtinEqPresets are the presets that come with Winamp.
+var builtinEqPresets = []EqPreset{
+	eqPresetFromLevels("Classical", 33, [eqBandCount]byte{33, 33, 33, 33, 33, 33, 20, 20, 20, 16}),
+	eqPresetFromLevels("Club", 33, [eqBandCount]byte{33, 33, 38, 42, 42, 42, 38, 33, 33, 33}),
+	eqPresetFromLevels("Dance", 33, [eqBandCount]byte{48, 44, 36, 32, 32, 22, 20, 20, 32, 32}),
+	eqPresetFromLevels("Flat", 33, [eqBandCount]byte{33, 33, 33, 33, 33, 33, 33, 33, 33, 33}),
+	eqPresetFromLevels("Full Bass", 33, [eqBandCount]byte{48, 48, 48, 42, 35, 25, 18, 15, 14, 14}),
+	eqPresetFromLevels("Full Bass & Treble", 33, [eqBandCount]byte{44, 42, 33, 20, 24, 35, 46, 50, 52, 52}),
+	eqPresetFromLevels("Full Treble", 33, [eqBandCount]byte{16, 16, 16, 25, 37, 50, 58, 58, 58, 60}),
+	eqPresetFromLevels("Laptop speakers/headphones", 33, [eqBandCount]byte{40, 50, 41, 26, 28, 35, 40, 48, 53, 53}),
+	eqPresetFromLevels("Large Hall", 33, [eqBandCount]byte{49, 49, 42, 42, 33, 24, 24, 24, 33, 33}),
+	eqPresetFromLevels("Live", 33, [eqBandCount]byte{24, 33, 39, 41, 42, 42, 39, 37, 37, 36}),
+	eqPresetFromLevels("Party", 33, [eqBandCount]byte{44, 44, 33, 33, 33, 33, 33, 33, 44, 44}),
+	eqPresetFromLevels("Pop", 33, [eqBandCount]byte{29, 40, 44, 45, 41, 30, 28, 28, 29, 29}),
+	eqPresetFromLevels("Reggae", 33, [eqBandCount]byte{33, 33, 31, 22, 33, 43, 43, 33, 33, 33}),
+	eqPresetFromLevels("Rock", 33, [eqBandCount]byte{45, 40, 23, 19, 26, 39, 47, 50, 50, 50}),
+	eqPresetFromLevels("Ska", 33, [eqBandCount]byte{28, 24, 25, 31, 39, 42, 47, 48, 50, 48}),
+	eqPresetFromLevels("Soft", 33, [eqBandCount]byte{40, 35, 30, 28, 30, 39, 46, 48, 50, 52}),
+	eqPresetFromLevels("Soft Rock", 33, [eqBandCount]byte{39, 39, 36, 31, 25, 23, 26, 31, 37, 47}),
+	eqPresetFromLevels("Techno", 33, [eqBandCount]byte{45, 42, 33, 23, 24, 33, 45, 48, 48, 47}),
+}
+
+// eqLibraryPath is where the presets saved by the user are kept, in the same format as Winamp's winamp.q1.
+func eqLibraryPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cosoPlayer", "winamp.q1"), nil
+}
+
+// loadEqLibrary returns the presets saved by the user, none if they never saved one.
+func loadEqLibrary() ([]EqPreset, error) {
+	path, err := eqLibraryPath()
+	if err != nil {
+		return nil, err
+	}
+	presets, err := loadEQFFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return presets, err
+}
+
+func saveEqLibrary(presets []EqPreset) error {
+	path, err := eqLibraryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating presets directory: %w", err)
+	}
+	return saveEQFFile(path, presets)
+}
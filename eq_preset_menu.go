@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// eqPresetExtensions are the files presets are loaded from, single presets and whole libraries.
+var eqPresetExtensions = []string{".eqf", ".q1"}
+
+// eqPresetMenu is the menu of the PRESETS button of the EQ window. Presets saved by name go to the library, the
+// built-in ones can't be changed.
+type eqPresetMenu struct {
+	w  fyne.Window
+	eq *Equalizer
+	// applied is called after the gains of eq were changed.
+	applied func()
+}
+
+// show opens the menu under button.
+func (m *eqPresetMenu) show(button *AnimatedSprite) error {
+	library, err := loadEqLibrary()
+	if err != nil {
+		return fmt.Errorf("loading presets: %w", err)
+	}
+	var load []*fyne.MenuItem
+	for _, preset := range append(append([]EqPreset(nil), builtinEqPresets...), library...) {
+		preset := preset
+		load = append(load, fyne.NewMenuItem(preset.Name, func() {
+			m.apply(preset)
+		}))
+	}
+	load = append(load, fyne.NewMenuItemSeparator(), fyne.NewMenuItem("From EQF...", m.loadFile))
+	loadItem := fyne.NewMenuItem("Load", nil)
+	loadItem.ChildMenu = fyne.NewMenu("", load...)
+
+	saveItem := fyne.NewMenuItem("Save", nil)
+	saveItem.ChildMenu = fyne.NewMenu("",
+		fyne.NewMenuItem("Preset...", m.savePreset),
+		fyne.NewMenuItem("To EQF...", m.saveFile))
+	items := []*fyne.MenuItem{loadItem, saveItem}
+
+	if len(library) > 0 {
+		var remove []*fyne.MenuItem
+		for _, preset := range library {
+			name := preset.Name
+			remove = append(remove, fyne.NewMenuItem(name, func() {
+				m.showError(m.deletePreset(name))
+			}))
+		}
+		deleteItem := fyne.NewMenuItem("Delete", nil)
+		deleteItem.ChildMenu = fyne.NewMenu("", remove...)
+		items = append(items, deleteItem)
+	}
+
+	widget.ShowPopUpMenuAtPosition(fyne.NewMenu("", items...), m.w.Canvas(), fyne.NewPos(
+		float32(button.AbsolutePositionX*scaleFactor),
+		float32((button.AbsolutePositionY+button.Image.SpriteHeight)*scaleFactor)))
+	return nil
+}
+
+func (m *eqPresetMenu) showError(err error) {
+	if err != nil {
+		dialog.ShowError(err, m.w)
+	}
+}
+
+func (m *eqPresetMenu) apply(preset EqPreset) {
+	preset.Apply(m.eq)
+	m.applied()
+}
+
+// loadFile applies the preset of an .eqf file, libraries with several presets are added to ours and the first one
+// is applied.
+func (m *eqPresetMenu) loadFile() {
+	fileOpen := dialog.NewFileOpen(func(uri fyne.URIReadCloser, err error) {
+		if err != nil || uri == nil {
+			return
+		}
+		uri.Close()
+		presets, err := loadEQFFile(uri.URI().Path())
+		if err != nil {
+			m.showError(err)
+			return
+		}
+		if len(presets) == 0 {
+			m.showError(fmt.Errorf("no presets in %s", uri.URI().Name()))
+			return
+		}
+		if len(presets) > 1 {
+			m.showError(m.addPresets(presets...))
+		}
+		m.apply(presets[0])
+	}, m.w)
+	fileOpen.SetFilter(storage.NewExtensionFileFilter(eqPresetExtensions))
+	fileOpen.Show()
+}
+
+// savePreset asks for a name and keeps the current gains in the library under it.
+func (m *eqPresetMenu) savePreset() {
+	name := widget.NewEntry()
+	dialog.ShowForm("Save preset", "Save", "Cancel", []*widget.FormItem{
+		widget.NewFormItem("Name", name),
+	}, func(ok bool) {
+		if !ok || strings.TrimSpace(name.Text) == "" {
+			return
+		}
+		m.showError(m.addPresets(eqPresetOf(strings.TrimSpace(name.Text), m.eq)))
+	}, m.w)
+}
+
+// saveFile writes the current gains to an .eqf file, the preset is named after it.
+func (m *eqPresetMenu) saveFile() {
+	fileSave := dialog.NewFileSave(func(uri fyne.URIWriteCloser, err error) {
+		if err != nil || uri == nil {
+			return
+		}
+		uri.Close()
+		path := uri.URI().Path()
+		if !strings.EqualFold(filepath.Ext(path), ".eqf") {
+			// the dialog already created the file with the name given
+			os.Remove(path)
+			path += ".eqf"
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		m.showError(saveEQFFile(path, []EqPreset{eqPresetOf(name, m.eq)}))
+	}, m.w)
+	fileSave.SetFileName("preset.eqf")
+	fileSave.SetFilter(storage.NewExtensionFileFilter([]string{".eqf"}))
+	fileSave.Show()
+}
+
+// addPresets saves presets in the library, replacing those with the same name.
+func (m *eqPresetMenu) addPresets(presets ...EqPreset) error {
+	library, err := loadEqLibrary()
+	if err != nil {
+		return err
+	}
+	for _, preset := range presets {
+		replaced := false
+		for i := range library {
+			if strings.EqualFold(library[i].Name, preset.Name) {
+				library[i] = preset
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			library = append(library, preset)
+		}
+	}
+	return saveEqLibrary(library)
+}
+
+func (m *eqPresetMenu) deletePreset(name string) error {
+	library, err := loadEqLibrary()
+	if err != nil {
+		return err
+	}
+	kept := library[:0]
+	for _, preset := range library {
+		if preset.Name != name {
+			kept = append(kept, preset)
+		}
+	}
+	if len(kept) == len(library) {
+		return fmt.Errorf("preset %q not found", name)
+	}
+	return saveEqLibrary(kept)
+}
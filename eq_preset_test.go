@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadEQF(t *testing.T) {
+	rock := EqPreset{Name: "Rock", Preamp: eqfGain(31)}
+	flat := EqPreset{Name: "Flat", Preamp: eqfGain(0)}
+	for band := range rock.Bands {
+		rock.Bands[band] = eqfGain(byte(band * 6))
+		flat.Bands[band] = eqfGain(31)
+	}
+	var library bytes.Buffer
+	if err := writeEQF(&library, []EqPreset{rock, flat}); err != nil {
+		t.Fatal(err)
+	}
+	whole := library.Bytes()
+
+	tests := []struct {
+		name    string
+		data    []byte
+		presets []EqPreset
+		err     error
+	}{
+		{"round trip", whole, []EqPreset{rock, flat}, nil},
+		{"no presets", []byte(eqfHeader), nil, nil},
+		{"empty", nil, nil, errNotEQF},
+		{"short header", []byte(eqfHeader[:len(eqfHeader)-2]), nil, errNotEQF},
+		{"other file", append([]byte("RIFF"), whole[4:]...), nil, errNotEQF},
+		{"trailing partial preset", whole[:len(whole)-5], []EqPreset{rock}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			presets, err := readEQF(bytes.NewReader(test.data))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if !reflect.DeepEqual(presets, test.presets) {
+				t.Errorf("got %+v, want %+v", presets, test.presets)
+			}
+		})
+	}
+}
+
+// TestReadEQFFixture reads a library laid out byte by byte as Winamp writes winamp.q1: the header, then for each
+// preset its name NUL padded to 257 bytes, the levels of the 10 bands and the one of the preamp.
+func TestReadEQFFixture(t *testing.T) {
+	fixture := "Winamp EQ library file v1.1\x1a!--" +
+		"Custom" + strings.Repeat("\x00", 251) +
+		"\x00\x3f\x15\x2a\xff\x00\x15\x2a\x3f\x15" + "\x2a" +
+		"Loud" + strings.Repeat("\x00", 253) +
+		"\x15\x15\x15\x15\x15\x15\x15\x15\x15\x15" + "\x00"
+	want := []EqPreset{
+		{Name: "Custom", Preamp: -4, Bands: [eqBandCount]float64{12, -12, 4, -4, -12, 12, 4, -4, -12, 4}},
+		{Name: "Loud", Preamp: 12, Bands: [eqBandCount]float64{4, 4, 4, 4, 4, 4, 4, 4, 4, 4}},
+	}
+	presets, err := readEQF(strings.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(presets, want) {
+		t.Errorf("got %+v, want %+v", presets, want)
+	}
+}
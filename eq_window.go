@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+)
+
+// eqGraphWidth and eqGraphHeight are the size of the response graph of the EQ window.
+const eqGraphWidth = 113
+const eqGraphHeight = 19
+
+// eqGraph draws the response of the equalizer over the graph of the EQ window, the color of each row of the curve
+// and the preamp line come from eqmain.bmp.
+type eqGraph struct {
+	x, y       int
+	colors     Sprite
+	preampLine Sprite
+	// curve holds the rows each column of the curve covers, from top to bottom.
+	curve   [eqGraphWidth][2]int
+	preampY int
+}
+
+// update draws the curve for the current gains. Bands are spread evenly along the graph like the sliders below it
+// and the frequencies in between are interpolated logarithmically.
+func (g *eqGraph) update(eq *Equalizer) {
+	row := func(gain float64) int {
+		y := int(math.Round((1 - (gain+EqMaxGain)/(2*EqMaxGain)) * (eqGraphHeight - 1)))
+		return max(0, min(eqGraphHeight-1, y))
+	}
+	prev := -1
+	for col := range g.curve {
+		at := float64(col) / (eqGraphWidth - 1) * float64(eqBandCount-1)
+		band := min(int(at), eqBandCount-2)
+		freq := eqFrequencies[band] * math.Pow(eqFrequencies[band+1]/eqFrequencies[band], at-float64(band))
+		y := row(eq.Response(freq))
+		if prev < 0 {
+			prev = y
+		}
+		// join the columns so the curve has no holes when it is steep.
+		g.curve[col] = [2]int{min(y, prev), max(y, prev)}
+		prev = y
+	}
+	g.preampY = row(eq.Preamp())
+}
+
+func (g *eqGraph) DrawAtPosition(x, y int) color.Color {
+	col, row := x-g.x, y-g.y
+	if col < 0 || col >= eqGraphWidth || row < 0 || row >= eqGraphHeight {
+		return nil
+	}
+	if g.curve[col][0] <= row && row <= g.curve[col][1] {
+		return g.colors.At(0, row)
+	}
+	if row == g.preampY {
+		return g.preampLine.At(col, 0)
+	}
+	return nil
+}
+
+// eqSlider ties a slider of the EQ window to the gain it controls.
+type eqSlider struct {
+	id  string
+	get func() float64
+	set func(gain float64) error
+}
+
+// eqWindow builds the equalizer window from eqmain.bmp, it starts hidden. closed is called when the window is closed
+// from its own close button. The returned songLoaded has to be called with the path of every song that starts, for
+// the auto button.
+func eqWindow(a fyne.App, skin *Skin, skins *skinSwitcher, eq *Equalizer, closed func()) (fyne.Window,
+	func(song string), error) {
+	w := a.NewWindow("Equalizer")
+	w.SetPadded(false)
+	w.Resize(fyne.Size{
+		Width:  275 * scaleFactor,
+		Height: 116 * scaleFactor,
+	})
+
+	stack, err := stackFromFromDefinitions(skin, "./eq_sprites.json")
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading equalizer stack: %w", err)
+	}
+	graph := &eqGraph{
+		x: 86,
+		y: 17,
+		colors: Sprite{
+			File:            "eqmain.bmp",
+			SpritePositionX: 115,
+			SpritePositionY: 294,
+			SpriteHeight:    eqGraphHeight,
+			SpriteWidth:     1,
+		},
+		preampLine: Sprite{
+			File:            "eqmain.bmp",
+			SpritePositionX: 0,
+			SpritePositionY: 314,
+			SpriteHeight:    1,
+			SpriteWidth:     eqGraphWidth,
+		},
+	}
+	for _, sp := range []*Sprite{&graph.colors, &graph.preampLine} {
+		if err := sp.Load(skin, stack.fileCache); err != nil {
+			return nil, nil, fmt.Errorf("loading equalizer graph: %w", err)
+		}
+	}
+
+	bg := &Background{
+		stack:     stack,
+		textLayer: &TextLayer{},
+		overlays:  []layer{graph},
+	}
+	bg.setRegion(skin.Regions()[regionEqualizer])
+	widget := newBgWidget(bg)
+	widget.cursors = loadWindowCursors(skin, "eqnormal.cur", eqCursors)
+	w.SetContent(widget)
+	skins.add(func(skin *Skin) (func(), error) {
+		fileCache, err := stack.loadImages(skin)
+		if err != nil {
+			return nil, fmt.Errorf("loading equalizer stack: %w", err)
+		}
+		colors, preampLine := graph.colors, graph.preampLine
+		for _, sp := range []*Sprite{&colors, &preampLine} {
+			if err := sp.Load(skin, fileCache); err != nil {
+				return nil, fmt.Errorf("loading equalizer graph: %w", err)
+			}
+		}
+		region := skin.Regions()[regionEqualizer]
+		cursors := loadWindowCursors(skin, "eqnormal.cur", eqCursors)
+		return func() {
+			stack.useImages(skin, fileCache)
+			graph.colors, graph.preampLine = colors, preampLine
+			bg.setRegion(region)
+			widget.cursors = cursors
+			widget.Refresh()
+		}, nil
+	})
+
+	sliders := []eqSlider{{id: "eq.preamp", get: eq.Preamp, set: func(gain float64) error {
+		eq.SetPreamp(gain)
+		return nil
+	}}}
+	for band := 0; band < eqBandCount; band++ {
+		band := band
+		sliders = append(sliders, eqSlider{
+			id: fmt.Sprintf("eq.band.%d", band),
+			get: func() float64 {
+				gain, _ := eq.Band(band)
+				return gain
+			},
+			set: func(gain float64) error {
+				return eq.SetBand(band, gain)
+			},
+		})
+	}
+	// syncSliders moves the sliders to the gains of the equalizer.
+	syncSliders := func() {
+		for _, slider := range sliders {
+			// the top of the slider is the most gain.
+			level := (slider.get() + EqMaxGain) / (2 * EqMaxGain)
+			stack.FindByID(slider.id).DraggableSeek(1 - level)
+			stack.FindByID(slider.id + ".bg").SetFrameAt(level)
+		}
+		graph.update(eq)
+		widget.Refresh()
+	}
+	syncSliders()
+	for _, slider := range sliders {
+		slider := slider
+		thumb := stack.FindByID(slider.id)
+		background := stack.FindByID(slider.id + ".bg")
+		changed := func() error {
+			level := 1 - thumb.DraggablePosition()
+			background.SetFrameAt(level)
+			if err := slider.set(level*2*EqMaxGain - EqMaxGain); err != nil {
+				return err
+			}
+			graph.update(eq)
+			widget.Refresh()
+			return nil
+		}
+		stack.register(thumb.Action, changed)
+		stack.registerDrag(thumb.Action, changed)
+	}
+
+	stack.FindByID("eq.on").Toggled = eq.Enabled()
+	stack.register("EQ", func() error {
+		eq.SetEnabled(stack.FindByID("eq.on").Toggled)
+		return nil
+	})
+	auto := stack.FindByID("eq.auto")
+	stack.register("EQ_AUTO", func() error {
+		widget.Refresh()
+		return nil
+	})
+	// like Winamp, when auto is on each song that starts loads the preset of the library named after its file.
+	songLoaded := func(song string) {
+		if !auto.Toggled {
+			return
+		}
+		library, err := loadEqLibrary()
+		if err != nil {
+			fmt.Println(fmt.Errorf("loading presets: %w", err))
+			return
+		}
+		for _, preset := range library {
+			if strings.EqualFold(preset.Name, filepath.Base(song)) {
+				preset.Apply(eq)
+				syncSliders()
+				return
+			}
+		}
+	}
+	stack.register("PRESETS", func() error {
+		presets := &eqPresetMenu{w: w, eq: eq, applied: syncSliders}
+		return presets.show(stack.FindByID("eq.presets"))
+	})
+	hide := func() {
+		w.Hide()
+		closed()
+	}
+	stack.register("EQ_CLOSE", func() error {
+		hide()
+		return nil
+	})
+	w.SetCloseIntercept(hide)
+	return w, songLoaded, nil
+}
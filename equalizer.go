@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+// eqFrequencies are the center frequencies of the bands of the classic Winamp equalizer.
+var eqFrequencies = [...]float64{60, 170, 310, 600, 1000, 3000, 6000, 12000, 14000, 16000}
+
+const eqBandCount = len(eqFrequencies)
+
+// EqMaxGain is the most, in dB, a band or the preamp can boost or cut.
+const EqMaxGain = 12
+
+// eqQ gives the bands roughly the width of Winamp's, neighbouring bands overlap a bit so the response stays smooth.
+const eqQ = 1.0
+
+// biquad holds the coefficients of a second order IIR filter, normalized so a0 is 1.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// biquadState is the memory of a biquad for one channel.
+type biquadState struct {
+	x1, x2, y1, y2 float64
+}
+
+// peakingFilter boosts or cuts gain dB around freq, as in the Audio EQ Cookbook.
+func peakingFilter(freq, gain float64) biquad {
+	a := math.Pow(10, gain/40)
+	w0 := 2 * math.Pi * freq / sampleRate
+	alpha := math.Sin(w0) / (2 * eqQ)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha/a
+	return biquad{
+		b0: (1 + alpha*a) / a0,
+		b1: -2 * cos / a0,
+		b2: (1 - alpha*a) / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha/a) / a0,
+	}
+}
+
+func (f *biquad) process(s *biquadState, x float64) float64 {
+	y := f.b0*x + f.b1*s.x1 + f.b2*s.x2 - f.a1*s.y1 - f.a2*s.y2
+	s.x2, s.x1 = s.x1, x
+	s.y2, s.y1 = s.y1, y
+	return y
+}
+
+// response is the gain of the filter at freq, in dB.
+func (f *biquad) response(freq float64) float64 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*freq/sampleRate))
+	h := (complex(f.b0, 0) + complex(f.b1, 0)*z + complex(f.b2, 0)*z*z) /
+		(1 + complex(f.a1, 0)*z + complex(f.a2, 0)*z*z)
+	return 20 * math.Log10(cmplx.Abs(h))
+}
+
+// Equalizer is a 10 band graphic equalizer with preamp, it filters the PCM of its source on the way to oto. Gains
+// are in dB and can be changed while playing.
+type Equalizer struct {
+	src     io.ReadSeeker
+	mu      sync.Mutex
+	enabled bool
+	preamp  float64
+	gains   [eqBandCount]float64
+	filters [eqBandCount]biquad
+	state   [outputChannels][eqBandCount]biquadState
+}
+
+func newEqualizer(src io.ReadSeeker) *Equalizer {
+	e := &Equalizer{src: src}
+	for band := range e.filters {
+		e.filters[band] = peakingFilter(eqFrequencies[band], 0)
+	}
+	return e
+}
+
+// Frequencies returns the center frequency of each band, in Hz.
+func (e *Equalizer) Frequencies() []float64 {
+	return append([]float64(nil), eqFrequencies[:]...)
+}
+
+func (e *Equalizer) Enabled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enabled
+}
+
+// SetEnabled turns filtering on or off, gains are kept while off.
+func (e *Equalizer) SetEnabled(enabled bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if enabled && !e.enabled {
+		// whatever the filters remember is from long ago.
+		e.state = [outputChannels][eqBandCount]biquadState{}
+	}
+	e.enabled = enabled
+}
+
+func (e *Equalizer) Preamp() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.preamp
+}
+
+// SetPreamp sets the gain applied before the bands, it is clamped to ±EqMaxGain.
+func (e *Equalizer) SetPreamp(gain float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.preamp = clampGain(gain)
+}
+
+func (e *Equalizer) Band(band int) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if band < 0 || band >= eqBandCount {
+		return 0, fmt.Errorf("equalizer band %d out of range [0, %d)", band, eqBandCount)
+	}
+	return e.gains[band], nil
+}
+
+// SetBand sets the gain of one band, it is clamped to ±EqMaxGain.
+func (e *Equalizer) SetBand(band int, gain float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if band < 0 || band >= eqBandCount {
+		return fmt.Errorf("equalizer band %d out of range [0, %d)", band, eqBandCount)
+	}
+	e.gains[band] = clampGain(gain)
+	e.filters[band] = peakingFilter(eqFrequencies[band], e.gains[band])
+	return nil
+}
+
+// Bands returns the gain of every band.
+func (e *Equalizer) Bands() [eqBandCount]float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.gains
+}
+
+// SetBands sets the gain of every band at once.
+func (e *Equalizer) SetBands(gains [eqBandCount]float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for band, gain := range gains {
+		e.gains[band] = clampGain(gain)
+		e.filters[band] = peakingFilter(eqFrequencies[band], e.gains[band])
+	}
+}
+
+// Response is the gain of all the bands together at freq, in dB, the preamp is not included.
+func (e *Equalizer) Response(freq float64) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var gain float64
+	for band := range e.filters {
+		gain += e.filters[band].response(freq)
+	}
+	return gain
+}
+
+func clampGain(gain float64) float64 {
+	return math.Max(-EqMaxGain, math.Min(EqMaxGain, gain))
+}
+
+func (e *Equalizer) Read(p []byte) (int, error) {
+	n, err := e.src.Read(p)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.enabled {
+		return n, err
+	}
+	preamp := math.Pow(10, e.preamp/20)
+	for off := 0; off+bytesPerSample <= n; off += bytesPerSample {
+		state := &e.state[off/bytesPerSample%outputChannels]
+		v := float64(int16(binary.LittleEndian.Uint16(p[off:]))) * preamp
+		for band := range e.filters {
+			v = e.filters[band].process(&state[band], v)
+		}
+		binary.LittleEndian.PutUint16(p[off:], uint16(clampSample(v)))
+	}
+	return n, err
+}
+
+// Seek moves the source, what the filters remember doesn't belong to the new position so it is dropped.
+func (e *Equalizer) Seek(offset int64, whence int) (int64, error) {
+	pos, err := e.src.Seek(offset, whence)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.state = [outputChannels][eqBandCount]biquadState{}
+	return pos, err
+}
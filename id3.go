@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3v1Size is the size of an ID3v1 tag, the last bytes of the file.
+const id3v1Size = 128
+
+// readID3v1 reads the ID3v1 tag at the end of r, ID3v1.1 ones also have the track number.
+func readID3v1(r io.ReadSeeker) (TrackInfo, error) {
+	if _, err := r.Seek(-id3v1Size, io.SeekEnd); err != nil {
+		return TrackInfo{}, errNoTags
+	}
+	tag := make([]byte, id3v1Size)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return TrackInfo{}, err
+	}
+	if string(tag[:3]) != "TAG" {
+		return TrackInfo{}, errNoTags
+	}
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return strings.TrimSpace(latin1(b))
+	}
+	info := TrackInfo{
+		Title:   field(tag[3:33]),
+		Artist:  field(tag[33:63]),
+		Album:   field(tag[63:93]),
+		Year:    field(tag[93:97]),
+		Comment: field(tag[97:127]),
+	}
+	// ID3v1.1 takes the last byte of the comment for the track, after a NUL.
+	if tag[125] == 0 && tag[126] != 0 {
+		info.Track = int(tag[126])
+	}
+	if int(tag[127]) < len(id3Genres) {
+		info.Genre = id3Genres[tag[127]]
+	}
+	return info, nil
+}
+
+// id3v2 header flags.
+const (
+	id3Unsynchronisation = 0x80
+	id3ExtendedHeader    = 0x40
+)
+
+// readID3v2 reads the ID3v2.2, 2.3 or 2.4 tag at the start of r.
+func readID3v2(r io.ReadSeeker) (TrackInfo, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return TrackInfo{}, err
+	}
+	header := make([]byte, id3v2HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:3]) != "ID3" {
+		return TrackInfo{}, errNoTags
+	}
+	version, flags := header[3], header[5]
+	if version < 2 || version > 4 {
+		return TrackInfo{}, fmt.Errorf("unsupported ID3v2.%d tag", version)
+	}
+	// the size leaves out the header and the footer.
+	tag := make([]byte, syncsafe(header[6:]))
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return TrackInfo{}, fmt.Errorf("reading ID3v2 tag: %w", err)
+	}
+	// before 2.4 the whole tag is unsynchronised, 2.4 does it frame by frame.
+	if flags&id3Unsynchronisation != 0 && version < 4 {
+		tag = resynchronise(tag)
+	}
+	if flags&id3ExtendedHeader != 0 && version > 2 {
+		if len(tag) < 4 {
+			return TrackInfo{}, io.ErrUnexpectedEOF
+		}
+		// 2.3 doesn't count the size itself, 2.4 does and uses a syncsafe integer.
+		extended := int(binary.BigEndian.Uint32(tag)) + 4
+		if version == 4 {
+			extended = syncsafe(tag)
+		}
+		if extended > len(tag) {
+			return TrackInfo{}, io.ErrUnexpectedEOF
+		}
+		tag = tag[extended:]
+	}
+	return parseID3v2Frames(tag, version)
+}
+
+// id3v2.4 frame flags, 2.3 has the same ones in other bits.
+const (
+	id3FrameCompressed   = 0x0008
+	id3FrameEncrypted    = 0x0004
+	id3FrameUnsync       = 0x0002
+	id3FrameDataLength   = 0x0001
+	id3FrameGrouping     = 0x0040
+	id3v23FrameCompress  = 0x0080
+	id3v23FrameEncrypted = 0x0040
+	id3v23FrameGrouping  = 0x0020
+)
+
+// id3v22Frames maps the three letter frames of ID3v2.2 to their later names.
+var id3v22Frames = map[string]string{
+	"TT2": "TIT2",
+	"TP1": "TPE1",
+	"TAL": "TALB",
+	"TYE": "TYER",
+	"TRK": "TRCK",
+	"TCO": "TCON",
+	"COM": "COMM",
+	"TPA": "TPOS",
+	"TXX": "TXXX",
+	"PIC": "APIC",
+}
+
+func parseID3v2Frames(tag []byte, version byte) (TrackInfo, error) {
+	var info TrackInfo
+	headerSize, idSize := 10, 4
+	if version == 2 {
+		headerSize, idSize = 6, 3
+	}
+	for len(tag) >= headerSize && tag[0] != 0 {
+		id := string(tag[:idSize])
+		var size, flags int
+		switch version {
+		case 2:
+			size = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+			id = id3v22Frames[id]
+		case 3:
+			size = int(binary.BigEndian.Uint32(tag[4:]))
+			flags = int(binary.BigEndian.Uint16(tag[8:]))
+		case 4:
+			size = syncsafe(tag[4:])
+			flags = int(binary.BigEndian.Uint16(tag[8:]))
+		}
+		if size > len(tag)-headerSize {
+			// a broken frame ends the tag, what came before it is fine.
+			break
+		}
+		data := tag[headerSize : headerSize+size]
+		tag = tag[headerSize+size:]
+		data, err := id3FrameData(data, version, flags)
+		if err != nil {
+			// the frame is lost, not the tag.
+			continue
+		}
+		switch id {
+		case "TIT2":
+			info.Title = id3Text(data)
+		case "TPE1":
+			info.Artist = id3Text(data)
+		case "TALB":
+			info.Album = id3Text(data)
+		case "TYER", "TDRC":
+			// 2.4 has full timestamps, we only show the year.
+			if year := id3Text(data); len(year) >= 4 {
+				info.Year = year[:4]
+			}
+		case "TRCK":
+			// it can be the track and the total: 3/12.
+			info.Track = leadingNumber(id3Text(data))
+		case "TPOS":
+			info.Disc = leadingNumber(id3Text(data))
+		case "TCON":
+			info.Genre = id3Genre(id3Text(data))
+		case "COMM":
+			info.Comment = id3Comment(data)
+		case "TXXX":
+			// user defined texts are where taggers put ReplayGain.
+			if len(data) > 0 {
+				description, rest := id3String(data[1:], data[0])
+				value, _ := id3String(rest, data[0])
+				info.setField(strings.ToLower(description), value)
+			}
+		case "APIC":
+			if picture, ok := id3Picture(data, version); ok {
+				info.Pictures = append(info.Pictures, picture)
+			}
+		}
+	}
+	if info.empty() {
+		return info, errNoTags
+	}
+	return info, nil
+}
+
+// id3FrameData undoes what the flags of a frame say was done to its data.
+func id3FrameData(data []byte, version byte, flags int) ([]byte, error) {
+	compressed, encrypted, grouping, unsync, dataLength := false, false, false, false, false
+	switch version {
+	case 3:
+		compressed, encrypted, grouping = flags&id3v23FrameCompress != 0, flags&id3v23FrameEncrypted != 0,
+			flags&id3v23FrameGrouping != 0
+		// compressed frames start with the decompressed size.
+		dataLength = compressed
+	case 4:
+		compressed, encrypted, grouping = flags&id3FrameCompressed != 0, flags&id3FrameEncrypted != 0,
+			flags&id3FrameGrouping != 0
+		unsync, dataLength = flags&id3FrameUnsync != 0, flags&id3FrameDataLength != 0
+	}
+	if encrypted {
+		return nil, errors.New("encrypted frame")
+	}
+	skip := 0
+	if grouping {
+		skip++
+	}
+	if dataLength {
+		skip += 4
+	}
+	if skip > len(data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data = data[skip:]
+	if unsync {
+		data = resynchronise(data)
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return data, nil
+}
+
+// resynchronise undoes unsynchronisation, the 0x00 added after every 0xFF so no byte pattern looks like an MPEG sync.
+func resynchronise(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// syncsafe decodes the 28 bit integers of ID3v2, 7 bits per byte.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// id3 text encodings.
+const (
+	id3Latin1  = 0
+	id3UTF16   = 1
+	id3UTF16BE = 2
+	id3UTF8    = 3
+)
+
+// id3Text decodes a text frame, its first byte is the encoding. Frames holding several values get the first one.
+func id3Text(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	text, _ := id3String(data[1:], data[0])
+	return strings.TrimSpace(text)
+}
+
+// id3Comment decodes a comment frame: the encoding, the language, a description and the comment.
+func id3Comment(data []byte) string {
+	if len(data) < 4 {
+		return ""
+	}
+	_, rest := id3String(data[4:], data[0])
+	text, _ := id3String(rest, data[0])
+	return strings.TrimSpace(text)
+}
+
+// id3Picture decodes a picture frame: the encoding, the MIME type, the picture type, a description and the image.
+// ID3v2.2 has a three letter format, as in JPG, in place of the MIME type.
+func id3Picture(data []byte, version byte) (Picture, bool) {
+	if len(data) < 2 {
+		return Picture{}, false
+	}
+	encoding, rest := data[0], data[1:]
+	var mime string
+	if version == 2 {
+		if len(rest) < 3 {
+			return Picture{}, false
+		}
+		mime, rest = "image/"+strings.ToLower(string(rest[:3])), rest[3:]
+		if mime == "image/jpg" {
+			mime = "image/jpeg"
+		}
+	} else {
+		mime, rest = id3String(rest, id3Latin1)
+	}
+	if len(rest) < 1 {
+		return Picture{}, false
+	}
+	picture := Picture{Type: int(rest[0]), MIMEType: mime}
+	picture.Description, rest = id3String(rest[1:], encoding)
+	picture.Data = rest
+	return picture, len(rest) > 0
+}
+
+// id3String decodes the NUL terminated string at the start of b and returns what follows it.
+func id3String(b []byte, encoding byte) (string, []byte) {
+	if encoding != id3UTF16 && encoding != id3UTF16BE {
+		end, next := len(b), len(b)
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			end, next = i, i+1
+		}
+		if encoding == id3UTF8 {
+			return string(b[:end]), b[next:]
+		}
+		return latin1(b[:end]), b[next:]
+	}
+	// the terminator of UTF-16 is two NULs aligned to a character.
+	end, next := len(b)&^1, len(b)
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			end, next = i, i+2
+			break
+		}
+	}
+	return decodeUTF16(b[:end], encoding == id3UTF16BE), b[next:]
+}
+
+// decodeUTF16 decodes UTF-16 text, a byte order mark overrides bigEndian.
+func decodeUTF16(b []byte, bigEndian bool) string {
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xff && b[1] == 0xfe:
+			bigEndian, b = false, b[2:]
+		case b[0] == 0xfe && b[1] == 0xff:
+			bigEndian, b = true, b[2:]
+		}
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = binary.BigEndian.Uint16(b[2*i:])
+		} else {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// id3Genre turns genres given as ID3v1 numbers, "17" or "(17)" and in ID3v2.3 optionally followed by a refinement
+// as in "(17)Rock & Roll", into names.
+func id3Genre(genre string) string {
+	rest := genre
+	number := -1
+	for strings.HasPrefix(rest, "(") && !strings.HasPrefix(rest, "((") {
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			break
+		}
+		if n, err := strconv.Atoi(rest[1:end]); err == nil && number < 0 {
+			number = n
+		}
+		rest = rest[end+1:]
+	}
+	if rest != "" {
+		if n, err := strconv.Atoi(rest); err == nil {
+			number, rest = n, ""
+		}
+	}
+	if rest != "" {
+		return strings.TrimPrefix(rest, "(")
+	}
+	if number >= 0 && number < len(id3Genres) {
+		return id3Genres[number]
+	}
+	return genre
+}
+
+// id3Genres are the genres of ID3v1 including Winamp's additions, by number.
+var id3Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz", "Metal",
+	"New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno", "Industrial",
+	"Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal",
+	"Jazz+Funk", "Fusion", "Trance", "Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel",
+	"Noise", "AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+	// Winamp's
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebob", "Latin", "Revival", "Celtic",
+	"Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock",
+	"Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech", "Chanson", "Opera",
+	"Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam", "Club",
+	"Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle", "Duet", "Punk Rock",
+	"Drum Solo", "A capella", "Euro-House", "Dance Hall",
+}
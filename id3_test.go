@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// id3v1Tag builds an ID3v1.1 tag.
+func id3v1Tag(title, artist, album, year, comment string, track, genre byte) []byte {
+	tag := make([]byte, id3v1Size)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[63:93], album)
+	copy(tag[93:97], year)
+	copy(tag[97:125], comment)
+	tag[126] = track
+	tag[127] = genre
+	return tag
+}
+
+// id3Frame builds a frame with the header of version.
+func id3Frame(version byte, id string, data []byte) []byte {
+	var header []byte
+	switch version {
+	case 2:
+		header = append([]byte(id), byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	case 3:
+		header = binary.BigEndian.AppendUint32([]byte(id), uint32(len(data)))
+		header = append(header, 0, 0)
+	case 4:
+		size := len(data)
+		header = append([]byte(id), byte(size>>21&0x7f), byte(size>>14&0x7f), byte(size>>7&0x7f), byte(size&0x7f))
+		header = append(header, 0, 0)
+	}
+	return append(header, data...)
+}
+
+// id3v2Tag builds a tag holding frames, the padding is left empty as taggers do.
+func id3v2Tag(version, flags byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	body = append(body, make([]byte, 16)...)
+	size := len(body)
+	tag := []byte{'I', 'D', '3', version, 0, flags,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(tag, body...)
+}
+
+// utf16Text is s in UTF-16 with a little endian byte order mark, only for ASCII.
+func utf16Text(s string) []byte {
+	b := []byte{0xff, 0xfe}
+	for _, c := range []byte(s) {
+		b = append(b, c, 0)
+	}
+	return b
+}
+
+func TestReadID3v1(t *testing.T) {
+	file := append([]byte("audio"), id3v1Tag("Title", "Artist", "Album", "1999", "Comment", 7, 17)...)
+	info, err := readID3v1(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TrackInfo{Title: "Title", Artist: "Artist", Album: "Album", Year: "1999", Comment: "Comment", Track: 7,
+		Genre: "Rock"}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+	for _, data := range [][]byte{nil, []byte("TAG"), make([]byte, id3v1Size)} {
+		if _, err := readID3v1(bytes.NewReader(data)); !errors.Is(err, errNoTags) {
+			t.Errorf("%d bytes without a tag: got error %v, want %v", len(data), err, errNoTags)
+		}
+	}
+}
+
+func TestReadID3v2(t *testing.T) {
+	cover := []byte("\x89PNG image")
+	tests := []struct {
+		name string
+		tag  []byte
+		info TrackInfo
+	}{
+		{
+			name: "2.2",
+			tag: id3v2Tag(2, 0,
+				id3Frame(2, "TT2", []byte("\x00Title")),
+				id3Frame(2, "TP1", []byte("\x00Artist")),
+				id3Frame(2, "TRK", []byte("\x003/12")),
+				id3Frame(2, "PIC", append([]byte("\x00JPG\x03Cover\x00"), cover...))),
+			info: TrackInfo{Title: "Title", Artist: "Artist", Track: 3,
+				Pictures: []Picture{{Type: pictureFrontCover, MIMEType: "image/jpeg", Description: "Cover", Data: cover}}},
+		},
+		{
+			name: "2.3 UTF-16",
+			tag: id3v2Tag(3, 0,
+				id3Frame(3, "TIT2", append([]byte{id3UTF16}, utf16Text("Title")...)),
+				id3Frame(3, "TCON", []byte("\x00(17)Rock & Roll")),
+				id3Frame(3, "TYER", []byte("\x001999")),
+				id3Frame(3, "COMM", bytes.Join([][]byte{{id3UTF16}, []byte("eng"), utf16Text(""), {0, 0},
+					utf16Text("Comment")}, nil)),
+				id3Frame(3, "TXXX", []byte("\x00REPLAYGAIN_TRACK_GAIN\x00-6.50 dB")),
+				id3Frame(3, "TXXX", []byte("\x00replaygain_track_peak\x000.9")),
+				id3Frame(3, "APIC", append([]byte("\x00image/png\x00\x03\x00"), cover...))),
+			info: TrackInfo{Title: "Title", Genre: "Rock & Roll", Year: "1999", Comment: "Comment",
+				ReplayGain: ReplayGain{TrackGain: -6.5, TrackPeak: 0.9, HasTrack: true},
+				Pictures:   []Picture{{Type: pictureFrontCover, MIMEType: "image/png", Data: cover}}},
+		},
+		{
+			name: "2.4 UTF-8",
+			tag: id3v2Tag(4, 0,
+				id3Frame(4, "TIT2", []byte("\x03Títle\x00Second value")),
+				id3Frame(4, "TDRC", []byte("\x032001-02-03")),
+				id3Frame(4, "TPOS", []byte("\x032/2")),
+				id3Frame(4, "TCON", []byte("\x0317"))),
+			info: TrackInfo{Title: "Títle", Year: "2001", Disc: 2, Genre: "Rock"},
+		},
+		{
+			name: "2.3 unsynchronised",
+			// the frame size is the one of the frame once resynchronised.
+			tag: id3v2Tag(3, id3Unsynchronisation,
+				bytes.ReplaceAll(id3Frame(3, "TIT2", []byte("\x00\xffTitle")), []byte{0xff}, []byte{0xff, 0})),
+			info: TrackInfo{Title: "ÿTitle"},
+		},
+		{
+			name: "broken frame keeps the ones before it",
+			tag: id3v2Tag(3, 0,
+				id3Frame(3, "TIT2", []byte("\x00Title")),
+				[]byte("TPE1\x7f\xff\xff\xff\x00\x00")),
+			info: TrackInfo{Title: "Title"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := readID3v2(bytes.NewReader(append(test.tag, "audio"...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(info, test.info) {
+				t.Errorf("got %+v, want %+v", info, test.info)
+			}
+		})
+	}
+}
+
+// TestReadID3v2Truncated reads every prefix of a tag, none should panic.
+func TestReadID3v2Truncated(t *testing.T) {
+	for _, version := range []byte{2, 3, 4} {
+		ids := map[byte][]string{2: {"TT2", "COM", "PIC"}, 3: {"TIT2", "COMM", "APIC"}, 4: {"TIT2", "COMM", "APIC"}}
+		tag := id3v2Tag(version, 0,
+			id3Frame(version, ids[version][0], append([]byte{id3UTF16}, utf16Text("Title")...)),
+			id3Frame(version, ids[version][1], []byte("\x00engdesc\x00comment")),
+			id3Frame(version, ids[version][2], []byte("\x00PNG\x03desc\x00data")))
+		for n := range tag {
+			readID3v2(bytes.NewReader(tag[:n]))
+			parseID3v2Frames(tag[min(n, id3v2HeaderSize):n], version)
+		}
+	}
+}
+
+func TestID3Genre(t *testing.T) {
+	for genre, want := range map[string]string{
+		"17":               "Rock",
+		"(17)":             "Rock",
+		"(17)Rock & Roll":  "Rock & Roll",
+		"((Parenthesised)": "(Parenthesised)",
+		"Shoegaze":         "Shoegaze",
+		"(999)":            "(999)",
+	} {
+		if got := id3Genre(genre); got != want {
+			t.Errorf("id3Genre(%q) = %q, want %q", genre, got, want)
+		}
+	}
+}
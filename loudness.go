@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// replayGainReference is the loudness ReplayGain 2.0 brings songs to, in LUFS.
+const replayGainReference = -18
+
+// EBU R128 measures loudness over blocks of 400ms overlapping by 75%, so every 100ms segment ends a block.
+const (
+	loudnessSegment       = sampleRate / 10
+	loudnessBlockSegments = 4
+	// blocks quieter than the absolute gate are silence, those quieter than the relative one, below the loudness
+	// of the rest, are pauses.
+	loudnessAbsoluteGate = -70
+	loudnessRelativeGate = -10
+)
+
+// kWeighting is the filter of ITU BS.1770 that loudness is measured through: a shelf boosting highs as the head does
+// and a high pass. These are the coefficients for any sample rate, as worked out by libebur128.
+func kWeighting(rate float64) [2]biquad {
+	k := math.Tan(math.Pi * 1681.974450955533 / rate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	k = math.Tan(math.Pi * 38.13547087602444 / rate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// loudnessMeter measures the integrated loudness and the peak of PCM in the output format.
+type loudnessMeter struct {
+	filters [2]biquad
+	state   [outputChannels][2]biquadState
+	// sum is the energy of the segment being measured, frames long so far.
+	sum    float64
+	frames int
+	// segments are the mean energies of the last segments, blocks those of every block.
+	segments []float64
+	blocks   []float64
+	peak     float64
+}
+
+func newLoudnessMeter() *loudnessMeter {
+	return &loudnessMeter{filters: kWeighting(sampleRate)}
+}
+
+func (m *loudnessMeter) Write(p []byte) (int, error) {
+	for off := 0; off+outputFrameSize <= len(p); off += outputFrameSize {
+		for ch := 0; ch < outputChannels; ch++ {
+			v := float64(int16(binary.LittleEndian.Uint16(p[off+ch*bytesPerSample:]))) / -math.MinInt16
+			m.peak = math.Max(m.peak, math.Abs(v))
+			for i := range m.filters {
+				v = m.filters[i].process(&m.state[ch][i], v)
+			}
+			// left and right weigh the same.
+			m.sum += v * v
+		}
+		m.frames++
+		if m.frames < loudnessSegment {
+			continue
+		}
+		m.segments = append(m.segments, m.sum/loudnessSegment)
+		m.sum, m.frames = 0, 0
+		if len(m.segments) < loudnessBlockSegments {
+			continue
+		}
+		var block float64
+		for _, segment := range m.segments {
+			block += segment
+		}
+		m.blocks = append(m.blocks, block/loudnessBlockSegments)
+		m.segments = m.segments[1:]
+	}
+	return len(p), nil
+}
+
+func energyLoudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// integrated is the loudness of everything written, in LUFS, gated as EBU R128 says. It reports false for silence.
+func (m *loudnessMeter) integrated() (float64, bool) {
+	gated := func(gate float64) (float64, bool) {
+		var sum float64
+		var count int
+		for _, block := range m.blocks {
+			if energyLoudness(block) > gate {
+				sum += block
+				count++
+			}
+		}
+		if count == 0 {
+			return 0, false
+		}
+		return sum / float64(count), true
+	}
+	energy, ok := gated(loudnessAbsoluteGate)
+	if !ok {
+		return 0, false
+	}
+	energy, ok = gated(math.Max(loudnessAbsoluteGate, energyLoudness(energy)+loudnessRelativeGate))
+	if !ok {
+		return 0, false
+	}
+	return energyLoudness(energy), true
+}
+
+// analyzeLoudness decodes the song at path to find the ReplayGain it has no tags for, songs that are all silence
+// get none.
+func analyzeLoudness(path string) (ReplayGain, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ReplayGain{}, fmt.Errorf("opening %q failed: %w", path, err)
+	}
+	defer f.Close()
+	decoded, err := newDecoder(path, newReadAheadReader(f))
+	if err != nil {
+		return ReplayGain{}, fmt.Errorf("decoding %q failed: %w", path, err)
+	}
+	m := newLoudnessMeter()
+	if _, err := io.Copy(m, newResampler(decoded)); err != nil {
+		return ReplayGain{}, fmt.Errorf("analyzing %q: %w", path, err)
+	}
+	lufs, ok := m.integrated()
+	if !ok {
+		return ReplayGain{}, nil
+	}
+	return ReplayGain{TrackGain: replayGainReference - lufs, TrackPeak: m.peak, HasTrack: true}, nil
+}
+
+// loudnessEntry is the analysis of a song, it is stale when the file changed since.
+type loudnessEntry struct {
+	Size    int64
+	ModTime time.Time
+	Gain    float64
+	Peak    float64
+	Silent  bool `json:",omitempty"`
+}
+
+// loudnessCache keeps the analysis of songs without ReplayGain tags so they are only decoded twice the first time
+// they are played, it is kept in the user's cache directory. Songs are analyzed one at a time.
+type loudnessCache struct {
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]loudnessEntry
+	// waiting are the callers of lookup for the songs being analyzed.
+	waiting map[string][]func(ReplayGain)
+	work    chan string
+}
+
+var loudness = &loudnessCache{}
+
+func loudnessCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cosoPlayer", "loudness.json"), nil
+}
+
+// lookup returns the ReplayGain of the song at path if it was analyzed before, otherwise it starts analyzing it and
+// done is called with the result, from another goroutine.
+func (c *loudnessCache) lookup(path string, done func(ReplayGain)) (ReplayGain, bool) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return ReplayGain{}, false
+	}
+	fInfo, err := os.Stat(path)
+	if err != nil {
+		return ReplayGain{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded {
+		c.load()
+	}
+	if entry, ok := c.entries[path]; ok && entry.Size == fInfo.Size() && entry.ModTime.Equal(fInfo.ModTime()) {
+		if entry.Silent {
+			return ReplayGain{}, true
+		}
+		return ReplayGain{TrackGain: entry.Gain, TrackPeak: entry.Peak, HasTrack: true}, true
+	}
+	if c.work == nil {
+		c.work = make(chan string, 16)
+		go c.analyze()
+	}
+	if _, ok := c.waiting[path]; !ok {
+		select {
+		case c.work <- path:
+		default:
+			// too much to do, it will be analyzed next time.
+			return ReplayGain{}, false
+		}
+	}
+	c.waiting[path] = append(c.waiting[path], done)
+	return ReplayGain{}, false
+}
+
+// analyze works through the songs queued by lookup.
+func (c *loudnessCache) analyze() {
+	for path := range c.work {
+		fInfo, err := os.Stat(path)
+		var rg ReplayGain
+		if err == nil {
+			rg, err = analyzeLoudness(path)
+		}
+		c.mu.Lock()
+		waiting := c.waiting[path]
+		delete(c.waiting, path)
+		if err != nil {
+			c.mu.Unlock()
+			fmt.Println(err)
+			continue
+		}
+		c.entries[path] = loudnessEntry{
+			Size:    fInfo.Size(),
+			ModTime: fInfo.ModTime(),
+			Gain:    rg.TrackGain,
+			Peak:    rg.TrackPeak,
+			Silent:  !rg.HasTrack,
+		}
+		err = c.save()
+		c.mu.Unlock()
+		if err != nil {
+			fmt.Println(fmt.Errorf("saving loudness cache: %w", err))
+		}
+		for _, done := range waiting {
+			done(rg)
+		}
+	}
+}
+
+// load reads the cache saved by previous runs, a missing or broken one is started anew. It must be called with the
+// lock held.
+func (c *loudnessCache) load() {
+	c.loaded = true
+	c.entries = make(map[string]loudnessEntry)
+	c.waiting = make(map[string][]func(ReplayGain))
+	path, err := loudnessCachePath()
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Println(fmt.Errorf("loading loudness cache: %w", err))
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		fmt.Println(fmt.Errorf("loading loudness cache: %w", err))
+		c.entries = make(map[string]loudnessEntry)
+	}
+}
+
+// save writes the cache, it must be called with the lock held.
+func (c *loudnessCache) save() error {
+	path, err := loudnessCachePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
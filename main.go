@@ -3,22 +3,38 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"os"
+	"path/filepath"
+	"time"
 
 	"fyne.io/fyne/v2/app"
 )
 
 const scaleFactor = 2
 
-func stackFromFromDefinitions(skin *Skin) (*SpriteStack, error) {
+// Settings are the options the player is started with.
+type Settings struct {
+	// Crossfade is how long songs overlap, 0 plays them back to back.
+	Crossfade      time.Duration
+	CrossfadeCurve CrossfadeCurve
+	// ReplayGain is which gain of the songs evens out their loudness.
+	ReplayGain ReplayGainMode
+	// SkinsDir is where the skin browser looks for skins.
+	SkinsDir string
+}
+
+// stackFromFromDefinitions loads the sprites of a window from their definitions file, such as sprites.json.
+func stackFromFromDefinitions(skin *Skin, definitions string) (*SpriteStack, error) {
 	stack := SpriteStack{
 		skin:          skin,
 		fileCache:     map[string]image.Image{},
 		actionHandler: map[string]func() error{},
+		draggedItem:   -1,
 	}
-	f, err := os.Open("./sprites.json")
+	f, err := os.Open(definitions)
 	if err != nil {
 		return nil, err
 	}
@@ -31,17 +47,24 @@ func stackFromFromDefinitions(skin *Skin) (*SpriteStack, error) {
 }
 
 func main() {
-	if len(os.Args) == 1 {
+	settings := Settings{ReplayGain: ReplayGainTrack}
+	flag.DurationVar(&settings.Crossfade, "crossfade", 0, "how long songs overlap, 0 to play them back to back")
+	flag.Var(&settings.CrossfadeCurve, "crossfade-curve", "how volumes change while crossfading, linear or equal-power")
+	flag.Var(&settings.ReplayGain, "replaygain", "which ReplayGain songs are played at, track, album or off")
+	flag.StringVar(&settings.SkinsDir, "skins", "./skins", "the directory the skin browser lists skins from")
+	flag.Parse()
+	if flag.NArg() == 0 {
 		fmt.Println(errors.New("a path to a skin is expected"))
 		os.Exit(1)
 	}
-	skin, err := skinFromPath(os.Args[1])
+	skin, err := skinFromPath(flag.Arg(0))
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 	a := app.New()
-	w, err := mainWindow(a, skin)
+	skins := &skinSwitcher{path: filepath.Clean(flag.Arg(0))}
+	w, err := mainWindow(a, skin, skins, settings)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -2,14 +2,22 @@ package main
 
 import (
 	"fmt"
-	"path/filepath"
+	"math"
+	"os"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/storage"
 )
 
-func mainWindow(a fyne.App, skin *Skin) (fyne.Window, error) {
+// titleFlashTime is how long messages replace the song title.
+const titleFlashTime = 2 * time.Second
+
+func mainWindow(a fyne.App, skin *Skin, skins *skinSwitcher, settings Settings) (fyne.Window, error) {
 	w := a.NewWindow("It really whips the guanaco's ass!!!")
 	//drv, ok := a.Driver().(desktop.Driver)
 	//if !ok {
@@ -26,7 +34,7 @@ func mainWindow(a fyne.App, skin *Skin) (fyne.Window, error) {
 	})
 
 	// Load sprites
-	stack, err := stackFromFromDefinitions(skin)
+	stack, err := stackFromFromDefinitions(skin, "./sprites.json")
 	if err != nil {
 		return nil, fmt.Errorf("loading stack: %w", err)
 	}
@@ -78,33 +86,165 @@ func mainWindow(a fyne.App, skin *Skin) (fyne.Window, error) {
 	textLayer.sprites = append(textLayer.sprites, timeS)
 	textLayer.sprites = append(textLayer.sprites, timeM)
 
+	// bitrate and sample rate of the song, in the small font.
+	kbps := &TextSprite{
+		Text:              "   ",
+		File:              "text.bmp",
+		StrLen:            3,
+		Image:             ts.Image,
+		AbsolutePositionX: 111,
+		AbsolutePositionY: 43,
+		NoEllipsis:        true,
+	}
+	khz := &TextSprite{
+		Text:              "  ",
+		File:              "text.bmp",
+		StrLen:            2,
+		Image:             ts.Image,
+		AbsolutePositionX: 156,
+		AbsolutePositionY: 43,
+		NoEllipsis:        true,
+	}
+	textLayer.sprites = append(textLayer.sprites, kbps, khz)
+
+	vis := newVisualizer(24, 43, skin.VisPalette())
 	mainWindowBG := &Background{
 		stack:     stack,
 		textLayer: textLayer,
+		overlays:  []layer{vis},
 	}
+	mainWindowBG.setRegion(skin.Regions()[regionNormal])
 
 	stack.register("close", func() error {
 		w.Close()
 		return nil
 	})
 	widget := newBgWidget(mainWindowBG)
+	widget.cursors = loadWindowCursors(skin, "normal.cur", mainCursors)
 	w.SetContent(widget)
+	// clicking the visualization switches between the spectrum, the oscilloscope and nothing.
+	widget.pressed = func(x, y int, _ fyne.KeyModifier) bool {
+		if !vis.contains(x, y) {
+			return false
+		}
+		vis.SetMode(vis.Mode().Cycle())
+		return true
+	}
+
+	skins.add(func(skin *Skin) (func(), error) {
+		fileCache, err := stack.loadImages(skin)
+		if err != nil {
+			return nil, err
+		}
+		text, err := loadSkinImage(skin, ts.File)
+		if err != nil {
+			return nil, err
+		}
+		numbers, err := loadSkinImage(skin, timeM.File)
+		if err != nil {
+			return nil, err
+		}
+		palette := skin.VisPalette()
+		region := skin.Regions()[regionNormal]
+		cursors := loadWindowCursors(skin, "normal.cur", mainCursors)
+		return func() {
+			stack.useImages(skin, fileCache)
+			ts.Image = text
+			kbps.Image = text
+			khz.Image = text
+			timeM.Image = numbers
+			timeS.Image = numbers
+			vis.SetPalette(palette)
+			mainWindowBG.setRegion(region)
+			widget.cursors = cursors
+			widget.Refresh()
+		}, nil
+	})
+
+	// the title shows the song, other messages are flashed over it for a bit. The song changes on the player loop
+	// while flashes end on timers.
+	var songTitle atomic.Value
+	songTitle.Store(ts.Text)
+	var flashes atomic.Int64
+	flashTitle := func(message string) {
+		flash := flashes.Add(1)
+		ts.Set(message)
+		widget.Refresh()
+		time.AfterFunc(titleFlashTime, func() {
+			if flashes.Load() != flash {
+				return
+			}
+			ts.Set(songTitle.Load().(string))
+			widget.Refresh()
+		})
+	}
 
-	player, err := NewPlayer(func(elapsed, total uint64) error {
+	// the playlist editor and the equalizer window need the player, they are built right after it.
+	var plWin *playlistWindow
+	var eqSongLoaded func(song string)
+	player, err := NewPlayer(PlayerActions{Tick: func(elapsed, total uint64) error {
 		mins := elapsed / 60
 		seconds := elapsed - (mins * 60)
 		timeM.Set(fmt.Sprintf("%02d", mins))
 		timeS.Set(fmt.Sprintf("%02d", seconds))
 		perc := (float64(elapsed) * 100.0) / float64(total)
-		stack.FindByID("player.slider.seek").DraggableSeek(perc / 100)
+		// don't fight the user over the position bar.
+		if seekBar := stack.FindByID("player.slider.seek"); !stack.IsDragging(seekBar) {
+			seekBar.DraggableSeek(perc / 100)
+		}
 		widget.Refresh()
 		return nil
-	})
+	}, Song: func(position int, entry PlaylistEntry) error {
+		title := titleForDisplay(position, entry)
+		songTitle.Store(title)
+		ts.Set(title)
+		widget.Refresh()
+		if plWin != nil {
+			plWin.Refresh()
+		}
+		if eqSongLoaded != nil {
+			eqSongLoaded(entry.Path)
+		}
+		return nil
+	}, Stream: func(info StreamInfo) error {
+		kbpsText, khzText := streamForDisplay(info)
+		mono, stereo := 0, 0
+		switch {
+		case info.Channels == 1:
+			mono = 1
+		case info.Channels > 1:
+			stereo = 1
+		}
+		monoSprite, stereoSprite := stack.FindByID("mono"), stack.FindByID("stereo")
+		if kbps.Text == kbpsText && khz.Text == khzText && monoSprite.Frame == mono && stereoSprite.Frame == stereo {
+			return nil
+		}
+		kbps.Set(kbpsText)
+		khz.Set(khzText)
+		monoSprite.Frame, stereoSprite.Frame = mono, stereo
+		widget.Refresh()
+		return nil
+	}, Mode: func(shuffle bool, repeat RepeatMode) error {
+		stack.FindByID("Shuffle").Toggled = shuffle
+		stack.FindByID("Repeat").Toggled = repeat != RepeatOff
+		widget.Refresh()
+		return nil
+	}})
 	if err != nil {
 		panic(err)
 	}
 
+	player.SetCrossfade(settings.Crossfade, settings.CrossfadeCurve)
+	player.SetReplayGain(settings.ReplayGain)
 	go player.PlayerLoop()
+	go func() {
+		samples := make([]float32, visFFTSize)
+		for range time.Tick(visInterval) {
+			if vis.update(samples, player.Samples(samples)) {
+				widget.Refresh()
+			}
+		}
+	}()
 
 	stack.register("STOP", func() error {
 		return player.Stop()
@@ -117,19 +257,204 @@ func mainWindow(a fyne.App, skin *Skin) (fyne.Window, error) {
 		}
 		return nil
 	})
+	stack.register("PREV", func() error {
+		return player.Prev()
+	})
+	stack.register("NEXT", func() error {
+		return player.Next()
+	})
+	stack.register("SHUFFLE", func() error {
+		shuffle := !player.Shuffle()
+		if shuffle {
+			flashTitle("SHUFFLE: ON")
+		} else {
+			flashTitle("SHUFFLE: OFF")
+		}
+		return player.SetShuffle(shuffle)
+	})
+	stack.register("REPEAT", func() error {
+		// the button has two looks for three modes, the title says which one we are in.
+		repeat := player.Repeat().Cycle()
+		flashTitle("REPEAT: " + strings.ToUpper(repeat.String()))
+		return player.SetRepeat(repeat)
+	})
+	eqWin, eqSongLoaded, err := eqWindow(a, skin, skins, player.Equalizer(), func() {
+		stack.FindByID("eq").Toggled = false
+		widget.Refresh()
+	})
+	if err != nil {
+		return nil, err
+	}
+	stack.register("EQ_WINDOW", func() error {
+		if stack.FindByID("eq").Toggled {
+			eqWin.Show()
+		} else {
+			eqWin.Hide()
+		}
+		return nil
+	})
+	plWin, err = newPlaylistWindow(a, skin, skins, player, func() {
+		stack.FindByID("pl").Toggled = false
+		widget.Refresh()
+	})
+	if err != nil {
+		return nil, err
+	}
+	stack.register("PL_WINDOW", func() error {
+		if stack.FindByID("pl").Toggled {
+			plWin.Show()
+		} else {
+			plWin.Hide()
+		}
+		return nil
+	})
 	stack.register("PAUSE", func() error {
 		player.TogglePause()
 		return nil
 	})
+	stack.register("SEEK", func() error {
+		perc := stack.FindByID("player.slider.seek").DraggablePosition()
+		return player.Seek(time.Duration(perc * float64(player.Length())))
+	})
+	// volume and balance change while dragged, their backgrounds follow them as in Winamp.
+	volume, volumeBg := stack.FindByID("player.slider.volume"), stack.FindByID("player.slider.volume.bg")
+	volume.DraggableSeek(player.Volume())
+	volumeBg.SetFrameAt(player.Volume())
+	volumeChanged := func() error {
+		level := volume.DraggablePosition()
+		volumeBg.SetFrameAt(level)
+		player.SetVolume(level)
+		flashTitle(fmt.Sprintf("VOLUME: %d%%", int(math.Round(level*100))))
+		return nil
+	}
+	stack.register("VOLUME", volumeChanged)
+	stack.registerDrag("VOLUME", volumeChanged)
+	balance, balanceBg := stack.FindByID("player.slider.balance"), stack.FindByID("player.slider.balance.bg")
+	balance.DraggableSeek((player.Balance() + 1) / 2)
+	balanceBg.SetFrameAt(math.Abs(player.Balance()))
+	balanceChanged := func() error {
+		level := balance.DraggablePosition()*2 - 1
+		balanceBg.SetFrameAt(math.Abs(level))
+		player.SetBalance(level)
+		percent := int(math.Round(math.Abs(level) * 100))
+		switch {
+		case percent == 0:
+			flashTitle("BALANCE: CENTER")
+		case level < 0:
+			flashTitle(fmt.Sprintf("BALANCE: %d%% LEFT", percent))
+		default:
+			flashTitle(fmt.Sprintf("BALANCE: %d%% RIGHT", percent))
+		}
+		return nil
+	}
+	stack.register("BALANCE", balanceChanged)
+	stack.registerDrag("BALANCE", balanceChanged)
 	stack.register("EJECT", func() error {
-		dialog.NewFileOpen(func(uri fyne.URIReadCloser, err error) {
+		fileOpen := dialog.NewFileOpen(func(uri fyne.URIReadCloser, err error) {
+			if err != nil || uri == nil {
+				return
+			}
 			defer uri.Close()
-			player.LoadFile(uri.URI().Path())
-			fileName := filepath.Base(uri.URI().Path())
-			ts.Set(strings.ToUpper(fileName))
-			widget.Refresh()
-		}, w).Show()
+			entries := []PlaylistEntry{{Path: uri.URI().Path()}}
+			if isPlaylistFile(uri.URI().Path()) {
+				entries, err = loadPlaylistFile(uri.URI().Path())
+				if err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+			}
+			if err := player.LoadPlaylist(entries); err != nil {
+				dialog.ShowError(err, w)
+			}
+			plWin.changed()
+		}, w)
+		fileOpen.SetFilter(storage.NewExtensionFileFilter(append(supportedExtensions(), playlistExtensions()...)))
+		fileOpen.Show()
+		return nil
+	})
+	browser := newSkinBrowser(a, settings.SkinsDir, skins)
+	stack.register("SYSMENU", func() error {
+		showSpriteMenu(w, stack.FindByID("wa.sysmenu"),
+			fyne.NewMenuItem("Skin browser...", browser.show),
+			replayGainMenu(player, flashTitle),
+			fyne.NewMenuItemSeparator(),
+			fyne.NewMenuItem("Exit", w.Close))
 		return nil
 	})
+	// alt+s opens the skin browser, as in Winamp.
+	w.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyS,
+		Modifier: fyne.KeyModifierAlt,
+	}, func(fyne.Shortcut) {
+		browser.show()
+	})
+	// ctrl+s saves the playlist, like LIST > Save list in the playlist editor.
+	w.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyS,
+		Modifier: fyne.KeyModifierShortcutDefault,
+	}, func(fyne.Shortcut) {
+		showSavePlaylist(w, player)
+	})
 	return w, nil
 }
+
+// replayGainMenu picks the ReplayGain mode, the one in use is checked.
+func replayGainMenu(player *Player, flashTitle func(message string)) *fyne.MenuItem {
+	var items []*fyne.MenuItem
+	for _, mode := range []ReplayGainMode{ReplayGainTrack, ReplayGainAlbum, ReplayGainOff} {
+		mode := mode
+		item := fyne.NewMenuItem(strings.ToUpper(mode.String()[:1])+mode.String()[1:], func() {
+			player.SetReplayGain(mode)
+			flashTitle("REPLAYGAIN: " + strings.ToUpper(mode.String()))
+		})
+		item.Checked = player.ReplayGain() == mode
+		items = append(items, item)
+	}
+	item := fyne.NewMenuItem("ReplayGain", nil)
+	item.ChildMenu = fyne.NewMenu("", items...)
+	return item
+}
+
+// streamForDisplay formats the bitrate and sample rate for the three and two characters they have, blank when
+// unknown. Bitrates that don't fit are shown in thousands as Winamp does, 1411 is 1K4.
+func streamForDisplay(info StreamInfo) (kbps, khz string) {
+	kbps, khz = "   ", "  "
+	switch {
+	case info.Bitrate >= 1000:
+		kbps = fmt.Sprintf("%dK%d", info.Bitrate/1000, info.Bitrate%1000/100)
+	case info.Bitrate > 0:
+		kbps = fmt.Sprintf("%3d", info.Bitrate)
+	}
+	if info.SampleRate > 0 {
+		khz = fmt.Sprintf("%2d", info.SampleRate/1000)
+	}
+	return kbps, khz
+}
+
+// titleForDisplay formats a playlist entry for the title TextSprite, which only has upper case glyphs.
+func titleForDisplay(position int, entry PlaylistEntry) string {
+	return strings.ToUpper(formatTitle(titleFormat, position, entry))
+}
+
+// showSavePlaylist asks where to save the play queue, the format follows the extension given and defaults to m3u8.
+func showSavePlaylist(w fyne.Window, player *Player) {
+	fileSave := dialog.NewFileSave(func(uri fyne.URIWriteCloser, err error) {
+		if err != nil || uri == nil {
+			return
+		}
+		// we write it ourselves, by path, as relative entries depend on where the playlist is.
+		uri.Close()
+		path := uri.URI().Path()
+		if !isPlaylistFile(path) {
+			// the dialog already created the file with the name given
+			os.Remove(path)
+			path += ".m3u8"
+		}
+		if err := savePlaylistFile(path, player.Playlist().Entries()); err != nil {
+			dialog.ShowError(err, w)
+		}
+	}, w)
+	fileSave.SetFileName("playlist.m3u8")
+	fileSave.SetFilter(storage.NewExtensionFileFilter(playlistExtensions()))
+	fileSave.Show()
+}
@@ -1,31 +1,57 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"os"
+	"io"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/ebitengine/oto/v3"
-	"github.com/hajimehoshi/go-mp3"
 )
 
 type Player struct {
-	currentSong       string
-	otoContext        *oto.Context
-	player            *oto.Player
-	currentSongLength int64
-	tickAction        func(elapsed, total uint64) error
-	lastStart         time.Time
-	pauseTime         time.Time
-	playChan          chan struct{}
+	// mu guards the state below, it is changed both from the UI and from PlayerLoop.
+	mu         sync.Mutex
+	otoContext *oto.Context
+	// player is the only oto player, it plays stream for as long as the program runs.
+	player  *oto.Player
+	stream  *stream
+	eq      *Equalizer
+	balance *balancer
+	tap     *visTap
+	actions PlayerActions
+	// heard is the track the UI was last told about, nil if nothing is loaded.
+	heard    *track
+	paused   bool
+	playlist *Playlist
+	// tried is the track and playlist version that preloading was last attempted for, so a song that can't be
+	// opened isn't retried on every tick.
+	tried struct {
+		after   *track
+		version uint64
+	}
+	playChan chan struct{}
+}
+
+// PlayerActions are how the Player lets the UI know about its changes, any of them can be nil.
+type PlayerActions struct {
+	// Tick is called periodically while playing.
+	Tick func(elapsed, total uint64) error
+	// Song is called every time a song of the playlist starts, whether it was picked or followed the previous one.
+	Song func(position int, entry PlaylistEntry) error
+	// Mode is called when shuffle or repeat change.
+	Mode func(shuffle bool, repeat RepeatMode) error
+	// Stream is called with what the decoder of the song being heard tells about it along with Tick and Song, the
+	// bitrate of VBR songs changes as they play. It is zero when nothing is loaded.
+	Stream func(info StreamInfo) error
 }
 
 var singlePlayer *Player
 
 const sampleRate = 44100
 
-func NewPlayer(tickAction func(elapsed, total uint64) error) (*Player, error) {
+func NewPlayer(actions PlayerActions) (*Player, error) {
 	if singlePlayer != nil {
 		return singlePlayer, nil
 	}
@@ -38,10 +64,11 @@ func NewPlayer(tickAction func(elapsed, total uint64) error) (*Player, error) {
 	op.SampleRate = sampleRate
 
 	// Number of channels (aka locations) to play sounds from. Either 1 or 2.
-	// 1 is mono sound, and 2 is stereo (most speakers are stereo).
-	op.ChannelCount = 2
+	// 1 is mono sound, and 2 is stereo (most speakers are stereo), files with other
+	// layouts are converted by the resampler.
+	op.ChannelCount = outputChannels
 
-	// Format of the source. go-mp3's format is signed 16bit integers.
+	// Format of the source. Every Decoder yields signed 16bit integers.
 	op.Format = oto.FormatSignedInt16LE
 
 	// Remember that you should **not** create more than one context
@@ -52,99 +79,505 @@ func NewPlayer(tickAction func(elapsed, total uint64) error) (*Player, error) {
 	// It might take a bit for the hardware audio devices to be ready, so we wait on the channel.
 	<-readyChan
 	singlePlayer = &Player{
-		currentSong: "",
-		otoContext:  otoCtx,
-		tickAction:  tickAction,
-		playChan:    make(chan struct{}),
+		otoContext: otoCtx,
+		stream:     &stream{},
+		actions:    actions,
+		playlist:   NewPlaylist(),
+		// buffered so waking the loop never blocks, one pending wake up is enough.
+		playChan: make(chan struct{}, 1),
 	}
+	// Songs are spliced into a single stream so one ends right where the previous one did, it goes through the
+	// equalizer, the balance and the tap of the visualization on its way to oto. Paused by default.
+	singlePlayer.eq = newEqualizer(singlePlayer.stream)
+	singlePlayer.balance = newBalancer(singlePlayer.eq)
+	singlePlayer.tap = newVisTap(singlePlayer.balance)
+	singlePlayer.player = otoCtx.NewPlayer(singlePlayer.tap)
 	return singlePlayer, nil
 }
 
+// tickInterval is how often the Tick action is called while playing, often enough for the clock to not look late.
+const tickInterval = 250 * time.Millisecond
+
+func (p *Player) tick() error {
+	p.mu.Lock()
+	elapsed, total := p.position(), p.length()
+	info := p.streamInfo()
+	p.mu.Unlock()
+	if err := p.streamChanged(info); err != nil {
+		return err
+	}
+	if p.actions.Tick == nil {
+		return nil
+	}
+	return p.actions.Tick(uint64(elapsed.Seconds()), uint64(total.Seconds()))
+}
+
+// streamInfo is what the decoder of the song being heard tells, it must be called with the lock held.
+func (p *Player) streamInfo() StreamInfo {
+	if p.heard == nil {
+		return StreamInfo{}
+	}
+	return p.heard.decoder.StreamInfo()
+}
+
+func (p *Player) streamChanged(info StreamInfo) error {
+	if p.actions.Stream == nil {
+		return nil
+	}
+	return p.actions.Stream(info)
+}
+
+// wake lets PlayerLoop know that something started playing.
+func (p *Player) wake() {
+	select {
+	case p.playChan <- struct{}{}:
+	default:
+	}
+}
+
 func (p *Player) PlayerLoop() {
 	println("loop invoked")
 	for range p.playChan {
 		println("loop")
 		for {
-			if p.player == nil || !p.player.IsPlaying() {
+			playing, err := p.update()
+			if err != nil {
+				fmt.Println(fmt.Errorf("moving to the next song: %w", err))
+			}
+			if !playing {
 				break
 			}
-			err := p.tickAction(uint64(time.Since(p.lastStart).Seconds()), uint64(p.currentSongLength))
+			err = p.tick()
 			if err != nil {
-				p.player.Pause()
+				p.Pause()
 			}
-			time.Sleep(time.Second)
+			time.Sleep(tickInterval)
 		}
 	}
 	println("end loop")
 }
 
-const sampleSize = 4
+// update follows the stream while playing: it moves the playlist along when the next song starts being heard, loads
+// the song after the current one ahead of time so the stream can go on without a gap, and stops at the end of the
+// playlist. It reports whether we are playing afterwards.
+func (p *Player) update() (bool, error) {
+	p.mu.Lock()
+	st := p.stream.state(p.player.BufferedSize())
+	// a track fading out can be heard after the one replacing it was loaded, but we never go back to it.
+	if st.heard != nil && (p.heard == nil || st.heard.seq > p.heard.seq) {
+		p.heard = st.heard
+		if _, ok := p.playlist.Advance(); !ok || p.playlist.CurrentIndex() != st.heard.index {
+			// the playlist changed under the preloaded song, it is what's playing anyway.
+			p.playlist.SetCurrent(st.heard.index)
+		}
+		if err := p.stream.release(st.heard); err != nil {
+			fmt.Println(fmt.Errorf("closing previous song: %w", err))
+		}
+		return p.songLoaded(p.preload(st))
+	}
+	defer p.mu.Unlock()
+	err := p.preload(st)
+	if p.player.IsPlaying() || p.paused || !st.ended {
+		return p.player.IsPlaying(), err
+	}
+	if p.stream.state(0).next != nil {
+		// the stream ran dry before the next song was ready, oto has to be told it goes on.
+		if _, err := p.player.Seek(0, io.SeekCurrent); err != nil {
+			return false, err
+		}
+		p.player.Play()
+		return true, err
+	}
+	// end of the playlist, rewind the last song like Stop does.
+	if sErr := p.stop(); err == nil {
+		err = sErr
+	}
+	return false, err
+}
 
-func (p *Player) LoadFile(song string) error {
-	if p.player != nil {
-		if err := p.player.Close(); err != nil {
-			return fmt.Errorf("closing previous player: %w", err)
+// preload opens the song that follows the current one and queues it in the stream, a queued song is dropped if the
+// playlist changed since. It must be called with the lock held.
+func (p *Player) preload(st streamState) error {
+	version := p.playlist.Version()
+	if st.next != nil {
+		if st.next.version == version {
+			return nil
+		}
+		if err := p.stream.dropNext(); err != nil {
+			return err
 		}
 	}
-	fileBytes, err := os.ReadFile(song)
+	// until the current track of the stream is heard the playlist doesn't point at it.
+	if st.current == nil || st.current != p.heard || (p.tried.after == st.current && p.tried.version == version) {
+		return nil
+	}
+	p.tried.after, p.tried.version = st.current, version
+	index, entry, ok := p.playlist.Upcoming()
+	if !ok {
+		return nil
+	}
+	t, err := openTrack(index, entry)
+	if err != nil {
+		return err
+	}
+	t.version = version
+	return p.stream.setNext(t)
+}
+
+// songLoaded unlocks the player and lets the Song action know about the new song, it must be called with the lock held
+// after a song was loaded or started being heard.
+func (p *Player) songLoaded(err error) (bool, error) {
 	if err != nil {
-		return fmt.Errorf("reading %q failed: %w", song, err)
+		p.mu.Unlock()
+		return false, err
+	}
+	position := p.playlist.CurrentIndex()
+	if p.heard != nil {
+		p.playlist.SetInfo(p.heard.index, p.heard.entry.Path, p.heard.entry.Info, p.heard.length)
+	}
+	entry, _ := p.playlist.Current()
+	playing := p.player.IsPlaying()
+	info := p.streamInfo()
+	p.mu.Unlock()
+	if p.actions.Song != nil {
+		if err := p.actions.Song(position, entry); err != nil {
+			return playing, err
+		}
 	}
+	return playing, p.streamChanged(info)
+}
+
+// Playlist is the play queue, changes to it take effect on the next song change.
+func (p *Player) Playlist() *Playlist {
+	return p.playlist
+}
+
+func (p *Player) Shuffle() bool {
+	return p.playlist.Shuffle()
+}
 
-	// Convert the pure bytes into a reader object that can be used with the mp3 decoder
-	fileBytesReader := bytes.NewReader(fileBytes)
+// SetShuffle changes the play order, the UI hears about it through the Mode action.
+func (p *Player) SetShuffle(shuffle bool) error {
+	p.playlist.SetShuffle(shuffle)
+	return p.modeChanged()
+}
+
+func (p *Player) Repeat() RepeatMode {
+	return p.playlist.Repeat()
+}
+
+// SetRepeat changes what happens at the end of songs, the UI hears about it through the Mode action.
+func (p *Player) SetRepeat(repeat RepeatMode) error {
+	p.playlist.SetRepeat(repeat)
+	return p.modeChanged()
+}
+
+func (p *Player) modeChanged() error {
+	if p.actions.Mode == nil {
+		return nil
+	}
+	return p.actions.Mode(p.playlist.Shuffle(), p.playlist.Repeat())
+}
 
-	// Decode file
-	decodedMp3, err := mp3.NewDecoder(fileBytesReader)
+// LoadPlaylist replaces the play queue with entries and loads the first one.
+func (p *Player) LoadPlaylist(entries []PlaylistEntry) error {
+	p.mu.Lock()
+	p.playlist.Clear()
+	p.playlist.Add(entries...)
+	entry, ok := p.playlist.Current()
+	if !ok {
+		err := p.unload()
+		p.mu.Unlock()
+		if sErr := p.streamChanged(StreamInfo{}); err == nil {
+			err = sErr
+		}
+		return err
+	}
+	_, err := p.songLoaded(p.loadEntry(p.playlist.CurrentIndex(), entry))
+	return err
+}
+
+// PlayEntry jumps to the song at position in the playlist and plays it.
+func (p *Player) PlayEntry(position int) error {
+	p.mu.Lock()
+	if err := p.playlist.SetCurrent(position); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	entry, _ := p.playlist.Current()
+	return p.changeSong(position, entry, true)
+}
+
+// Next moves to the following song of the playlist, playback goes on if we were playing.
+func (p *Player) Next() error {
+	p.mu.Lock()
+	entry, ok := p.playlist.Next()
+	if !ok {
+		p.mu.Unlock()
+		return nil
+	}
+	return p.changeSong(p.playlist.CurrentIndex(), entry, p.player.IsPlaying())
+}
+
+// Prev moves to the preceding song of the playlist, playback goes on if we were playing.
+func (p *Player) Prev() error {
+	p.mu.Lock()
+	entry, ok := p.playlist.Prev()
+	if !ok {
+		p.mu.Unlock()
+		return nil
+	}
+	return p.changeSong(p.playlist.CurrentIndex(), entry, p.player.IsPlaying())
+}
+
+// changeSong loads entry and plays it if asked to, crossfading into it if we are playing. It must be called with the
+// lock held and releases it.
+func (p *Player) changeSong(index int, entry PlaylistEntry, play bool) error {
+	err := p.fadeToEntry(index, entry)
+	if err == nil && play {
+		p.player.Play()
+		p.wake()
+	}
+	_, err = p.songLoaded(err)
+	return err
+}
+
+// fadeToEntry is loadEntry but the song playing fades out while entry fades in, when crossfading is on.
+func (p *Player) fadeToEntry(index int, entry PlaylistEntry) error {
+	if !p.player.IsPlaying() {
+		return p.loadEntry(index, entry)
+	}
+	t, err := openTrack(index, entry)
+	if err != nil {
+		return err
+	}
+	faded, err := p.stream.crossfadeTo(t)
+	if !faded {
+		return p.loadTrack(t)
+	}
+	p.heard = t
+	return err
+}
+
+// loadEntry makes entry the song of the stream, whatever was playing or queued is dropped.
+func (p *Player) loadEntry(index int, entry PlaylistEntry) error {
+	t, err := openTrack(index, entry)
 	if err != nil {
-		return fmt.Errorf("mp3.NewDecoder failed: :%w", err)
+		return err
 	}
-	p.currentSongLength = (decodedMp3.Length() / sampleSize) / sampleRate
+	return p.loadTrack(t)
+}
 
-	// Create a new 'player' that will handle our sound. Paused by default.
-	p.player = singlePlayer.otoContext.NewPlayer(decodedMp3)
-	p.currentSong = song
+func (p *Player) loadTrack(t *track) error {
+	if err := p.stream.replace(t); err != nil {
+		fmt.Println(fmt.Errorf("closing previous song: %w", err))
+	}
+	p.heard = t
+	p.paused = false
+	// oto drops what it buffered of the previous song and forgets the stream may have ended before.
+	if _, err := p.player.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewinding %q: %w", t.entry.Path, err)
+	}
+	return nil
+}
+
+// unload leaves the stream empty, there is nothing to play until a song is loaded.
+func (p *Player) unload() error {
+	p.player.Pause()
+	err := p.stream.replace(nil)
+	p.heard = nil
+	p.paused = false
+	if _, sErr := p.player.Seek(0, io.SeekStart); err == nil {
+		err = sErr
+	}
+	return err
+}
+
+// LoadFile replaces the play queue with a single song.
+func (p *Player) LoadFile(song string) error {
+	return p.LoadPlaylist([]PlaylistEntry{{Path: song}})
+}
+
+// Equalizer is what everything played goes through, it starts disabled.
+func (p *Player) Equalizer() *Equalizer {
+	return p.eq
+}
+
+// Volume is how loud oto plays, from 0 to 1.
+func (p *Player) Volume() float64 {
+	return p.player.Volume()
+}
+
+// SetVolume sets how loud oto plays, from 0 to 1.
+func (p *Player) SetVolume(volume float64) {
+	p.player.SetVolume(math.Max(0, math.Min(1, volume)))
+}
+
+// Balance is how much sound goes to each side, from -1 for only the left one to 1 for only the right one.
+func (p *Player) Balance() float64 {
+	return p.balance.Balance()
+}
+
+func (p *Player) SetBalance(balance float64) {
+	p.balance.SetBalance(balance)
+}
+
+// Samples fills dst with what is being heard, mono and between -1 and 1, the last sample being the one playing now. It
+// reports false when nothing is playing.
+func (p *Player) Samples(dst []float32) bool {
+	// oto is never called with the lock held, and the tap has its own.
+	if !p.player.IsPlaying() {
+		return false
+	}
+	p.tap.samples(dst, int64(p.player.BufferedSize()/outputFrameSize))
+	return true
+}
+
+// SetCrossfade makes songs overlap for d when one follows another or on NEXT and PREV while playing, curve is how
+// their volumes change meanwhile. 0 plays songs back to back.
+func (p *Player) SetCrossfade(d time.Duration, curve CrossfadeCurve) {
+	p.stream.setCrossfade(d, curve)
+}
+
+func (p *Player) Crossfade() (time.Duration, CrossfadeCurve) {
+	return p.stream.crossfadeSettings()
+}
+
+// SetReplayGain picks the ReplayGain values songs are played at, it applies to the song playing too.
+func (p *Player) SetReplayGain(mode ReplayGainMode) {
+	p.stream.setReplayGain(mode)
+}
+
+func (p *Player) ReplayGain() ReplayGainMode {
+	return p.stream.replayGainMode()
+}
+
+// Length is the duration of the current song.
+func (p *Player) Length() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.length()
+}
+
+func (p *Player) length() time.Duration {
+	if p.heard == nil {
+		return 0
+	}
+	return p.heard.length
+}
+
+// Position is how much of the current song has been heard, it counts the frames oto took from the stream minus
+// those still waiting in its buffer, so it follows the audio even when the device stalls.
+func (p *Player) Position() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.position()
+}
+
+func (p *Player) position() time.Duration {
+	st := p.stream.state(p.player.BufferedSize())
+	return framesDuration(st.position/outputFrameSize, sampleRate)
+}
+
+// Seek moves playback of the current song to the given position, it keeps playing or stays paused.
+func (p *Player) Seek(position time.Duration) error {
+	if err := p.seek(position); err != nil {
+		return err
+	}
+	// the loop doesn't tick while paused
+	return p.tick()
+}
+
+func (p *Player) seek(position time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.heard == nil {
+		return nil
+	}
+	if position < 0 {
+		position = 0
+	}
+	if p.stream.state(0).current != p.heard {
+		// the end of the song being heard is still buffered but the stream already reads the next one, which is the
+		// one it would seek. The song being heard is opened again so the seek lands in it.
+		paused := p.paused
+		if err := p.loadEntry(p.heard.index, p.heard.entry); err != nil {
+			return err
+		}
+		p.paused = paused
+	}
+	frame := int64(position.Seconds() * sampleRate)
+	// oto drops whatever it had buffered and asks the stream for the new position.
+	if _, err := p.player.Seek(frame*outputFrameSize, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking to %s: %w", position, err)
+	}
 	return nil
 }
 
 func (p *Player) Stop() error {
-	if p.player == nil {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = false
+	return p.stop()
+}
+
+// stop pauses and rewinds the current song.
+func (p *Player) stop() error {
+	p.player.Pause()
+	if p.heard == nil {
 		return nil
 	}
-	err := p.player.Close()
-	p.player = nil
-	return err
+	if _, err := p.player.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewinding %q: %w", p.heard.entry.Path, err)
+	}
+	return nil
 }
 
 func (p *Player) Play() error {
-	if p.currentSong == "" || (p.player != nil && p.player.IsPlaying()) {
-		return nil
+	p.mu.Lock()
+	if p.heard == nil {
+		// songs added to an empty playlist are not loaded until asked to play.
+		entry, ok := p.playlist.Current()
+		if !ok {
+			p.mu.Unlock()
+			return nil
+		}
+		return p.changeSong(p.playlist.CurrentIndex(), entry, true)
 	}
-	if !p.pauseTime.IsZero() {
-		p.TogglePause()
+	defer p.mu.Unlock()
+	if p.player.IsPlaying() {
 		return nil
 	}
 	// Play starts playing the sound and returns without waiting for it (Play() is async).
 	p.player.Play()
-	p.lastStart = time.Now()
-	p.playChan <- struct{}{}
+	p.paused = false
+	p.wake()
 	return nil
 }
 
+// Pause pauses playback, unlike TogglePause it never resumes it.
+func (p *Player) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.player.IsPlaying() {
+		return
+	}
+	p.paused = true
+	p.player.Pause()
+}
+
 func (p *Player) TogglePause() {
-	if p.currentSong == "" {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.heard == nil {
 		return
 	}
 	if p.player.IsPlaying() {
-		p.pauseTime = time.Now()
+		p.paused = true
 		p.player.Pause()
 		return
 	}
-	p.lastStart = time.Now().Add(-(p.pauseTime.Sub(p.lastStart)))
-	fmt.Printf("Pause time: %#v\n", p.pauseTime)
-	fmt.Printf("Play start time: %#v\n", p.lastStart)
-	fmt.Printf("Pause - start diff: %#v\n", p.pauseTime.Sub(p.lastStart))
 	p.player.Play()
-	p.playChan <- struct{}{}
-	p.pauseTime = time.Time{}
+	p.wake()
+	p.paused = false
 }
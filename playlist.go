@@ -0,0 +1,492 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PlaylistEntry is a song in the play queue, Title and Length are optional and come from playlist files or tags.
+type PlaylistEntry struct {
+	Path   string
+	Title  string
+	Length time.Duration
+	// Info is filled from the tags of the song once it is opened.
+	Info TrackInfo
+}
+
+// DisplayTitle is what we show for the entry, "Artist - Title" when its tags are known.
+func (e PlaylistEntry) DisplayTitle() string {
+	if e.Info.Title != "" {
+		if e.Info.Artist != "" {
+			return e.Info.Artist + " - " + e.Info.Title
+		}
+		return e.Info.Title
+	}
+	if e.Title != "" {
+		return e.Title
+	}
+	return filepath.Base(e.Path)
+}
+
+// RepeatMode is what happens when the playlist runs out or a song ends.
+type RepeatMode int
+
+const (
+	// RepeatOff stops at the end of the playlist.
+	RepeatOff RepeatMode = iota
+	// RepeatAll starts the playlist over once it ends.
+	RepeatAll
+	// RepeatOne plays the current song again when it ends.
+	RepeatOne
+)
+
+func (m RepeatMode) String() string {
+	switch m {
+	case RepeatAll:
+		return "all"
+	case RepeatOne:
+		return "one"
+	default:
+		return "off"
+	}
+}
+
+// Cycle returns the mode that follows m when clicking the repeat button.
+func (m RepeatMode) Cycle() RepeatMode {
+	switch m {
+	case RepeatOff:
+		return RepeatAll
+	case RepeatAll:
+		return RepeatOne
+	default:
+		return RepeatOff
+	}
+}
+
+// Playlist is the ordered play queue and the position of the current song in it, it is safe to use from the UI
+// while the player moves through it.
+//
+// Songs are played following order, which holds indexes of entries. It is the identity unless shuffling, in which
+// case it is a permutation that visits every entry once, so going back and forth is stable.
+type Playlist struct {
+	mu      sync.Mutex
+	entries []PlaylistEntry
+	order   []int
+	// current is the index of the current song in entries, -1 if there is none.
+	current int
+	// orderPos is where current is in order.
+	orderPos int
+	// unplayed is set when the playing song was removed and current is the one that took its place, moving on
+	// goes to it rather than past it.
+	unplayed bool
+	shuffle  bool
+	repeat   RepeatMode
+	rand     *rand.Rand
+	// nextRound is the order to use once this one is over when repeating all while shuffling, it is made in advance
+	// so Upcoming knows what comes after the last song.
+	nextRound []int
+	// version changes with everything that can change what comes after the current song, other than moving through
+	// the queue.
+	version uint64
+}
+
+func NewPlaylist() *Playlist {
+	return &Playlist{
+		current: -1,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (pl *Playlist) Len() int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return len(pl.entries)
+}
+
+// Version changes every time the queue, the play order or the repeat mode do.
+func (pl *Playlist) Version() uint64 {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.version
+}
+
+// changed is called by everything that changes what Upcoming returns.
+func (pl *Playlist) changed() {
+	pl.version++
+	pl.nextRound = nil
+}
+
+// Entries returns a copy of the queue.
+func (pl *Playlist) Entries() []PlaylistEntry {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return append([]PlaylistEntry(nil), pl.entries...)
+}
+
+func (pl *Playlist) Entry(i int) (PlaylistEntry, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.entry(i)
+}
+
+func (pl *Playlist) entry(i int) (PlaylistEntry, error) {
+	if i < 0 || i >= len(pl.entries) {
+		return PlaylistEntry{}, fmt.Errorf("playlist entry %d out of range [0, %d)", i, len(pl.entries))
+	}
+	return pl.entries[i], nil
+}
+
+// SetInfo records what was learnt of the song at path once opened, the length is only taken if it wasn't known. It
+// does nothing if the entry at i is another song by now.
+func (pl *Playlist) SetInfo(i int, path string, info TrackInfo, length time.Duration) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if i < 0 || i >= len(pl.entries) || pl.entries[i].Path != path {
+		return
+	}
+	pl.entries[i].Info = info
+	if pl.entries[i].Length <= 0 {
+		pl.entries[i].Length = length
+	}
+}
+
+// CurrentIndex is the position of the current song, -1 when there is none.
+func (pl *Playlist) CurrentIndex() int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.current
+}
+
+func (pl *Playlist) Current() (PlaylistEntry, bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.current < 0 {
+		return PlaylistEntry{}, false
+	}
+	return pl.entries[pl.current], true
+}
+
+func (pl *Playlist) SetCurrent(i int) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if _, err := pl.entry(i); err != nil {
+		return err
+	}
+	pl.setCurrent(i)
+	pl.unplayed = false
+	return nil
+}
+
+// setCurrent makes entry i current and finds it in the play order.
+func (pl *Playlist) setCurrent(i int) {
+	pl.current = i
+	pl.orderPos = 0
+	for pos, entry := range pl.order {
+		if entry == i {
+			pl.orderPos = pos
+			return
+		}
+	}
+}
+
+func (pl *Playlist) Shuffle() bool {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.shuffle
+}
+
+// SetShuffle turns shuffling on or off, the current song stays current either way and when turning it on it becomes
+// the first of the new order.
+func (pl *Playlist) SetShuffle(shuffle bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.changed()
+	pl.shuffle = shuffle
+	if shuffle {
+		pl.reshuffle(pl.current)
+	} else {
+		pl.order = pl.order[:0]
+		for i := range pl.entries {
+			pl.order = append(pl.order, i)
+		}
+	}
+	pl.setCurrent(pl.current)
+}
+
+// reshuffle makes a new random order, first is put at the beginning unless it is -1.
+func (pl *Playlist) reshuffle(first int) {
+	pl.order = pl.rand.Perm(len(pl.entries))
+	for pos, entry := range pl.order {
+		if entry == first {
+			pl.order[0], pl.order[pos] = pl.order[pos], pl.order[0]
+			break
+		}
+	}
+}
+
+func (pl *Playlist) Repeat() RepeatMode {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.repeat
+}
+
+func (pl *Playlist) SetRepeat(repeat RepeatMode) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.changed()
+	pl.repeat = repeat
+}
+
+// Add appends entries at the end of the queue, the first one added to an empty queue becomes current. When
+// shuffling they land at random places of what is left to play in this round.
+func (pl *Playlist) Add(entries ...PlaylistEntry) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.changed()
+	for _, entry := range entries {
+		i := len(pl.entries)
+		pl.entries = append(pl.entries, entry)
+		pos := len(pl.order)
+		if pl.shuffle && pl.current >= 0 {
+			pos = pl.orderPos + 1 + pl.rand.Intn(len(pl.order)-pl.orderPos)
+		}
+		pl.order = append(pl.order, 0)
+		copy(pl.order[pos+1:], pl.order[pos:])
+		pl.order[pos] = i
+	}
+	if pl.current < 0 && len(pl.entries) > 0 {
+		// an empty queue was filled, there was nothing to shuffle the entries in among.
+		if pl.shuffle {
+			pl.reshuffle(-1)
+		}
+		pl.setCurrent(pl.order[0])
+	}
+}
+
+// Remove takes an entry out of the queue, the current song stays current unless it is the one removed, in which
+// case the one following it in play order is, and it is where Next and Advance go.
+func (pl *Playlist) Remove(i int) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if _, err := pl.entry(i); err != nil {
+		return err
+	}
+	pl.changed()
+	pl.entries = append(pl.entries[:i], pl.entries[i+1:]...)
+	order := pl.order[:0]
+	for _, entry := range pl.order {
+		switch {
+		case entry > i:
+			order = append(order, entry-1)
+		case entry < i:
+			order = append(order, entry)
+		}
+	}
+	pl.order = order
+	switch {
+	case len(pl.entries) == 0:
+		pl.current = -1
+		pl.orderPos = 0
+		pl.unplayed = false
+	case i == pl.current:
+		// the last song in play order has nothing taking its place, the one before it is current as it would be
+		// after playing.
+		pl.unplayed = pl.orderPos < len(pl.order)
+		pl.orderPos = min(pl.orderPos, len(pl.order)-1)
+		pl.current = pl.order[pl.orderPos]
+	case i < pl.current:
+		pl.setCurrent(pl.current - 1)
+	default:
+		pl.setCurrent(pl.current)
+	}
+	return nil
+}
+
+// Move puts the entry at from in position to, the current song is followed around. The play order is not affected.
+func (pl *Playlist) Move(from, to int) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	entry, err := pl.entry(from)
+	if err != nil {
+		return err
+	}
+	if _, err := pl.entry(to); err != nil {
+		return err
+	}
+	pl.changed()
+	if from < to {
+		copy(pl.entries[from:to], pl.entries[from+1:to+1])
+	} else {
+		copy(pl.entries[to+1:from+1], pl.entries[to:from])
+	}
+	pl.entries[to] = entry
+	moved := func(i int) int {
+		switch {
+		case i == from:
+			return to
+		case from < i && i <= to:
+			return i - 1
+		case to <= i && i < from:
+			return i + 1
+		}
+		return i
+	}
+	if pl.shuffle {
+		for pos := range pl.order {
+			pl.order[pos] = moved(pl.order[pos])
+		}
+	}
+	if pl.current >= 0 {
+		pl.setCurrent(moved(pl.current))
+	}
+	return nil
+}
+
+// Reorder rearranges the queue so the entry at order[i] ends up at i, the current song is followed around. The play
+// order is not affected.
+func (pl *Playlist) Reorder(order []int) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if len(order) != len(pl.entries) {
+		return fmt.Errorf("reordering %d entries with %d positions", len(pl.entries), len(order))
+	}
+	moved := make([]int, len(order))
+	for i := range moved {
+		moved[i] = -1
+	}
+	entries := make([]PlaylistEntry, len(order))
+	for i, from := range order {
+		if from < 0 || from >= len(pl.entries) || moved[from] >= 0 {
+			return fmt.Errorf("invalid playlist order %v", order)
+		}
+		moved[from] = i
+		entries[i] = pl.entries[from]
+	}
+	pl.changed()
+	pl.entries = entries
+	if pl.shuffle {
+		for pos := range pl.order {
+			pl.order[pos] = moved[pl.order[pos]]
+		}
+	}
+	if pl.current >= 0 {
+		pl.setCurrent(moved[pl.current])
+	}
+	return nil
+}
+
+func (pl *Playlist) Clear() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.changed()
+	pl.entries = nil
+	pl.order = nil
+	pl.current = -1
+	pl.orderPos = 0
+	pl.unplayed = false
+}
+
+// Next makes the following entry in play order current, it returns false at the end of the queue unless repeating
+// all, in which case it starts over, with a new order if shuffling.
+func (pl *Playlist) Next() (PlaylistEntry, bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.next()
+}
+
+func (pl *Playlist) next() (PlaylistEntry, bool) {
+	order, pos, ok := pl.following()
+	if !ok {
+		return PlaylistEntry{}, false
+	}
+	if pos == 0 && pl.nextRound != nil {
+		pl.order = order
+		pl.nextRound = nil
+	}
+	pl.orderPos = pos
+	pl.current = pl.order[pos]
+	pl.unplayed = false
+	return pl.entries[pl.current], true
+}
+
+// following returns the play order and position in it of the song after the current one, the order is the one of
+// the next round when wrapping.
+func (pl *Playlist) following() ([]int, int, bool) {
+	if len(pl.entries) == 0 {
+		return nil, 0, false
+	}
+	pos := pl.orderPos + 1
+	if pl.unplayed {
+		pos = pl.orderPos
+	}
+	if pos < len(pl.order) {
+		return pl.order, pos, true
+	}
+	if pl.repeat != RepeatAll {
+		return nil, 0, false
+	}
+	if !pl.shuffle {
+		return pl.order, 0, true
+	}
+	if pl.nextRound == nil {
+		pl.nextRound = pl.rand.Perm(len(pl.entries))
+		// don't play the same song twice in a row when wrapping
+		if len(pl.nextRound) > 1 && pl.nextRound[0] == pl.current {
+			pl.nextRound[0], pl.nextRound[1] = pl.nextRound[1], pl.nextRound[0]
+		}
+	}
+	return pl.nextRound, 0, true
+}
+
+// Upcoming returns the entry, and its index, that Advance would make current, so it can be loaded ahead of time.
+func (pl *Playlist) Upcoming() (int, PlaylistEntry, bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.current < 0 {
+		return -1, PlaylistEntry{}, false
+	}
+	if pl.repeat == RepeatOne {
+		return pl.current, pl.entries[pl.current], true
+	}
+	order, pos, ok := pl.following()
+	if !ok {
+		return -1, PlaylistEntry{}, false
+	}
+	return order[pos], pl.entries[order[pos]], true
+}
+
+// Advance moves on once the current song played to its end, unlike Next it stays on the current song when repeating
+// it.
+func (pl *Playlist) Advance() (PlaylistEntry, bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.current >= 0 && pl.repeat == RepeatOne {
+		pl.unplayed = false
+		return pl.entries[pl.current], true
+	}
+	return pl.next()
+}
+
+// Prev makes the preceding entry in play order current, it returns false at the beginning of the queue unless
+// repeating all, in which case it goes to the end.
+func (pl *Playlist) Prev() (PlaylistEntry, bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if len(pl.entries) == 0 {
+		return PlaylistEntry{}, false
+	}
+	pos := pl.orderPos - 1
+	if pos < 0 {
+		if pl.repeat != RepeatAll {
+			return PlaylistEntry{}, false
+		}
+		pos = len(pl.order) - 1
+	}
+	pl.orderPos = pos
+	pl.current = pl.order[pos]
+	pl.unplayed = false
+	return pl.entries[pl.current], true
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// playlistFormat knows how to read and write one of the playlist file formats, baseDir is the directory of the
+// playlist file which relative paths are resolved against.
+type playlistFormat struct {
+	read  func(r io.Reader, baseDir string) ([]PlaylistEntry, error)
+	write func(w io.Writer, entries []PlaylistEntry, baseDir string) error
+}
+
+var playlistFormats = map[string]playlistFormat{
+	".m3u":  {read: readM3U, write: writeM3U},
+	".m3u8": {read: readM3U, write: writeM3U},
+	".pls":  {read: readPLS, write: writePLS},
+}
+
+// playlistExtensions returns the extensions, dot included, of the playlist files we understand.
+func playlistExtensions() []string {
+	var extensions []string
+	for ext := range playlistFormats {
+		extensions = append(extensions, ext)
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+func isPlaylistFile(path string) bool {
+	_, ok := playlistFormats[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// loadPlaylistFile reads the entries of a playlist file, the format is picked by extension.
+func loadPlaylistFile(path string) ([]PlaylistEntry, error) {
+	format, ok := playlistFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("unknown playlist format: %s", filepath.Base(path))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening playlist: %w", err)
+	}
+	defer f.Close()
+	entries, err := format.read(f, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("reading playlist %s: %w", filepath.Base(path), err)
+	}
+	return entries, nil
+}
+
+// savePlaylistFile writes entries to a playlist file, the format is picked by extension.
+func savePlaylistFile(path string, entries []PlaylistEntry) error {
+	format, ok := playlistFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return fmt.Errorf("unknown playlist format: %s", filepath.Base(path))
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating playlist: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	err = format.write(w, entries, filepath.Dir(path))
+	if err == nil {
+		err = w.Flush()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing playlist %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// songsInDir returns an entry for every file we can play under dir, subdirectories included, sorted by path.
+func songsInDir(dir string) ([]PlaylistEntry, error) {
+	supported := map[string]bool{}
+	for _, ext := range supportedExtensions() {
+		supported[ext] = true
+	}
+	var entries []PlaylistEntry
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && supported[strings.ToLower(filepath.Ext(path))] {
+			entries = append(entries, PlaylistEntry{Path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", dir, err)
+	}
+	return entries, nil
+}
+
+// playlistLines splits a playlist into trimmed lines, old playlists are usually latin1 so anything that is not valid
+// UTF-8 is read as such.
+func playlistLines(r io.Reader) ([]string, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimPrefix(raw, []byte("\ufeff"))
+	text := string(raw)
+	if !utf8.Valid(raw) {
+		runes := make([]rune, len(raw))
+		for i, b := range raw {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return lines, nil
+}
+
+// resolvePlaylistPath turns a path found in a playlist into one we can open, it returns false for URLs of things we
+// can't play such as streams.
+func resolvePlaylistPath(location, baseDir string) (string, bool) {
+	if strings.Contains(location, "://") {
+		u, err := url.Parse(location)
+		if err != nil || u.Scheme != "file" {
+			return "", false
+		}
+		return filepath.FromSlash(u.Path), true
+	}
+	// playlists made on windows use backslashes
+	location = filepath.FromSlash(strings.ReplaceAll(location, `\`, "/"))
+	if !filepath.IsAbs(location) {
+		location = filepath.Join(baseDir, location)
+	}
+	return location, true
+}
+
+// relativePlaylistPath is the inverse of resolvePlaylistPath, songs under baseDir are written relative to it so the
+// playlist can be moved along with them.
+func relativePlaylistPath(path, baseDir string) string {
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// lengthFromSeconds parses the length fields of playlists, where -1 means unknown.
+func lengthFromSeconds(value string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func secondsFromLength(length time.Duration) int {
+	if length <= 0 {
+		return -1
+	}
+	return int(length.Round(time.Second) / time.Second)
+}
+
+// readM3U reads both plain and extended M3U, an #EXTINF line describes the path that follows it:
+//
+//	#EXTINF:<seconds>,<title>
+func readM3U(r io.Reader, baseDir string) ([]PlaylistEntry, error) {
+	lines, err := playlistLines(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []PlaylistEntry
+	var info PlaylistEntry
+	for _, line := range lines {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info = PlaylistEntry{}
+			length, title, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			// the length can be followed by attributes, as in #EXTINF:123 tvg-id="x",title
+			length, _, _ = strings.Cut(length, " ")
+			info.Length = lengthFromSeconds(length)
+			info.Title = strings.TrimSpace(title)
+		case strings.HasPrefix(line, "#"):
+		default:
+			path, ok := resolvePlaylistPath(line, baseDir)
+			if ok {
+				info.Path = path
+				entries = append(entries, info)
+			}
+			info = PlaylistEntry{}
+		}
+	}
+	return entries, nil
+}
+
+// writeM3U writes extended M3U in UTF-8, which is also valid M3U8.
+func writeM3U(w io.Writer, entries []PlaylistEntry, baseDir string) error {
+	if _, err := fmt.Fprint(w, "#EXTM3U\n"); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "#EXTINF:%d,%s\n%s\n",
+			secondsFromLength(e.Length), e.DisplayTitle(), relativePlaylistPath(e.Path, baseDir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPLS reads the ini like PLS format, entries are numbered from 1:
+//
+//	[playlist]
+//	File1=song.mp3
+//	Title1=A song
+//	Length1=123
+func readPLS(r io.Reader, baseDir string) ([]PlaylistEntry, error) {
+	lines, err := playlistLines(r)
+	if err != nil {
+		return nil, err
+	}
+	byNumber := map[int]*PlaylistEntry{}
+	inPlaylist := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "[") {
+			inPlaylist = strings.EqualFold(line, "[playlist]")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inPlaylist || !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		n, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+		e, ok := byNumber[n]
+		if !ok {
+			e = &PlaylistEntry{}
+			byNumber[n] = e
+		}
+		switch field {
+		case "file":
+			e.Path = value
+		case "title":
+			e.Title = value
+		case "length":
+			e.Length = lengthFromSeconds(value)
+		}
+	}
+	numbers := make([]int, 0, len(byNumber))
+	for n := range byNumber {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	var entries []PlaylistEntry
+	for _, n := range numbers {
+		e := byNumber[n]
+		if e.Path == "" {
+			continue
+		}
+		path, ok := resolvePlaylistPath(e.Path, baseDir)
+		if !ok {
+			continue
+		}
+		e.Path = path
+		entries = append(entries, *e)
+	}
+	return entries, nil
+}
+
+func writePLS(w io.Writer, entries []PlaylistEntry, baseDir string) error {
+	if _, err := fmt.Fprint(w, "[playlist]\n"); err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if _, err := fmt.Fprintf(w, "File%d=%s\nTitle%d=%s\nLength%d=%d\n",
+			i+1, relativePlaylistPath(e.Path, baseDir),
+			i+1, e.DisplayTitle(),
+			i+1, secondsFromLength(e.Length)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "NumberOfEntries=%d\nVersion=2\n", len(entries))
+	return err
+}
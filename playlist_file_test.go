@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var playlistBaseDir = filepath.FromSlash("/music/lists")
+
+func playlistFixture() []PlaylistEntry {
+	return []PlaylistEntry{
+		{Path: filepath.Join(playlistBaseDir, "a.mp3"), Title: "Artist - A", Length: 3*time.Minute + 5*time.Second},
+		{Path: filepath.Join(playlistBaseDir, "sub", "b.flac"), Title: "B", Length: 0},
+		{Path: filepath.FromSlash("/elsewhere/c.ogg"), Title: "C", Length: time.Second},
+	}
+}
+
+func TestPlaylistRoundTrip(t *testing.T) {
+	for _, ext := range playlistExtensions() {
+		t.Run(ext, func(t *testing.T) {
+			format := playlistFormats[ext]
+			var buf bytes.Buffer
+			if err := format.write(&buf, playlistFixture(), playlistBaseDir); err != nil {
+				t.Fatal(err)
+			}
+			// songs under the playlist are written relative to it.
+			if strings.Contains(buf.String(), filepath.Join(playlistBaseDir, "a.mp3")) {
+				t.Errorf("wrote absolute path for a song next to the playlist:\n%s", buf.String())
+			}
+			entries, err := format.read(&buf, playlistBaseDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, playlistFixture()) {
+				t.Errorf("got %+v, want %+v", entries, playlistFixture())
+			}
+		})
+	}
+}
+
+func TestReadM3U(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		entries []PlaylistEntry
+	}{
+		{
+			name: "plain",
+			data: "a.mp3\n/abs/b.mp3\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "a.mp3")},
+				{Path: filepath.FromSlash("/abs/b.mp3")},
+			},
+		},
+		{
+			name: "extended with CRLF",
+			data: "#EXTM3U\r\n#EXTINF:123,Song\r\nsub\\a.mp3\r\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "sub", "a.mp3"), Title: "Song", Length: 123 * time.Second},
+			},
+		},
+		{
+			name: "EXTINF lengths",
+			data: "#EXTINF:-1,Unknown\na.mp3\n#EXTINF:42 tvg-id=\"x\",Attributes\nb.mp3\n#EXTINF:soon,Broken\nc.mp3\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "a.mp3"), Title: "Unknown"},
+				{Path: filepath.Join(playlistBaseDir, "b.mp3"), Title: "Attributes", Length: 42 * time.Second},
+				{Path: filepath.Join(playlistBaseDir, "c.mp3"), Title: "Broken"},
+			},
+		},
+		{
+			name: "EXTINF only describes the next path",
+			data: "#EXTINF:10,First\na.mp3\nb.mp3\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "a.mp3"), Title: "First", Length: 10 * time.Second},
+				{Path: filepath.Join(playlistBaseDir, "b.mp3")},
+			},
+		},
+		{
+			name: "URLs",
+			data: "http://radio.example/stream\nfile:///abs/a.mp3\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.FromSlash("/abs/a.mp3")},
+			},
+		},
+		{
+			name: "latin1 with BOM",
+			data: "\ufeff#EXTINF:1,Caf\xe9\na.mp3\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "a.mp3"), Title: "Café", Length: time.Second},
+			},
+		},
+		{name: "EXTINF without a path", data: "#EXTM3U\n#EXTINF:10,Title"},
+		{name: "empty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := readM3U(strings.NewReader(test.data), playlistBaseDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, test.entries) {
+				t.Errorf("got %+v, want %+v", entries, test.entries)
+			}
+		})
+	}
+}
+
+func TestReadPLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		entries []PlaylistEntry
+	}{
+		{
+			name: "CRLF and NumberOfEntries",
+			data: "[playlist]\r\nFile1=a.mp3\r\nTitle1=A\r\nLength1=-1\r\nNumberOfEntries=1\r\nVersion=2\r\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "a.mp3"), Title: "A"},
+			},
+		},
+		{
+			name: "NumberOfEntries doesn't limit the entries",
+			data: "[playlist]\nNumberOfEntries=1\nFile1=a.mp3\nFile2=b.mp3\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "a.mp3")},
+				{Path: filepath.Join(playlistBaseDir, "b.mp3")},
+			},
+		},
+		{
+			name: "numbered out of order",
+			data: "[Playlist]\nfile10=b.mp3\nlength10=7\nFILE2=a.mp3\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "a.mp3")},
+				{Path: filepath.Join(playlistBaseDir, "b.mp3"), Length: 7 * time.Second},
+			},
+		},
+		{
+			name: "entries without a file and other sections",
+			data: "[other]\nFile1=x.mp3\n[playlist]\nTitle1=No file\nFile2=http://radio.example/\nFile3=c.mp3\n",
+			entries: []PlaylistEntry{
+				{Path: filepath.Join(playlistBaseDir, "c.mp3")},
+			},
+		},
+		{name: "no section", data: "File1=a.mp3\n"},
+		{name: "keys without numbers", data: "[playlist]\nFile=a.mp3\nFilex=b.mp3\nLength1\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := readPLS(strings.NewReader(test.data), playlistBaseDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(entries, test.entries) {
+				t.Errorf("got %+v, want %+v", entries, test.entries)
+			}
+		})
+	}
+}
+
+// TestReadPlaylistTruncated reads every prefix of valid playlists, none should fail or panic.
+func TestReadPlaylistTruncated(t *testing.T) {
+	for _, ext := range playlistExtensions() {
+		format := playlistFormats[ext]
+		var buf bytes.Buffer
+		if err := format.write(&buf, playlistFixture(), playlistBaseDir); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.String()
+		for n := range data {
+			if _, err := format.read(strings.NewReader(data[:n]), playlistBaseDir); err != nil {
+				t.Errorf("%s truncated to %d bytes: %v", ext, n, err)
+			}
+		}
+	}
+}
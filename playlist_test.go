@@ -0,0 +1,404 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// testPlaylist is a playlist of songs named by paths, shuffled with a fixed seed.
+func testPlaylist(paths ...string) *Playlist {
+	pl := NewPlaylist()
+	pl.rand = rand.New(rand.NewSource(1))
+	for _, path := range paths {
+		pl.Add(PlaylistEntry{Path: path})
+	}
+	return pl
+}
+
+func playlistPaths(pl *Playlist) []string {
+	var paths []string
+	for _, entry := range pl.Entries() {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
+
+// upcomingPath is the song Upcoming returns, "" for none.
+func upcomingPath(pl *Playlist) string {
+	_, entry, ok := pl.Upcoming()
+	if !ok {
+		return ""
+	}
+	return entry.Path
+}
+
+func TestPlaylistCurrent(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int
+		change  func(pl *Playlist) error
+		paths   []string
+		// wantCurrent is the index of the current song afterwards and upcoming the song that follows it.
+		wantCurrent int
+		upcoming    string
+		wantErr     bool
+	}{
+		{
+			name:        "remove before the current song",
+			current:     2,
+			change:      func(pl *Playlist) error { return pl.Remove(0) },
+			paths:       []string{"b", "c", "d", "e"},
+			wantCurrent: 1,
+			upcoming:    "d",
+		},
+		{
+			name:        "remove after the current song",
+			current:     2,
+			change:      func(pl *Playlist) error { return pl.Remove(4) },
+			paths:       []string{"a", "b", "c", "d"},
+			wantCurrent: 2,
+			upcoming:    "d",
+		},
+		{
+			name:    "remove the current song",
+			current: 2,
+			change:  func(pl *Playlist) error { return pl.Remove(2) },
+			paths:   []string{"a", "b", "d", "e"},
+			// the song that took its place is the one to play next, not the one after it.
+			wantCurrent: 2,
+			upcoming:    "d",
+		},
+		{
+			name:        "remove the current song at the end",
+			current:     4,
+			change:      func(pl *Playlist) error { return pl.Remove(4) },
+			paths:       []string{"a", "b", "c", "d"},
+			wantCurrent: 3,
+			upcoming:    "",
+		},
+		{
+			name:    "remove every song",
+			current: 0,
+			change: func(pl *Playlist) error {
+				for pl.Len() > 0 {
+					if err := pl.Remove(0); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			wantCurrent: -1,
+		},
+		{
+			name:        "remove out of range",
+			current:     1,
+			change:      func(pl *Playlist) error { return pl.Remove(5) },
+			paths:       []string{"a", "b", "c", "d", "e"},
+			wantCurrent: 1,
+			upcoming:    "c",
+			wantErr:     true,
+		},
+		{
+			name:        "move the current song",
+			current:     1,
+			change:      func(pl *Playlist) error { return pl.Move(1, 3) },
+			paths:       []string{"a", "c", "d", "b", "e"},
+			wantCurrent: 3,
+			upcoming:    "e",
+		},
+		{
+			name:        "move a song from before the current one to after it",
+			current:     2,
+			change:      func(pl *Playlist) error { return pl.Move(0, 4) },
+			paths:       []string{"b", "c", "d", "e", "a"},
+			wantCurrent: 1,
+			upcoming:    "d",
+		},
+		{
+			name:        "move a song from after the current one to before it",
+			current:     2,
+			change:      func(pl *Playlist) error { return pl.Move(4, 0) },
+			paths:       []string{"e", "a", "b", "c", "d"},
+			wantCurrent: 3,
+			upcoming:    "d",
+		},
+		{
+			name:        "move out of range",
+			current:     2,
+			change:      func(pl *Playlist) error { return pl.Move(0, 5) },
+			paths:       []string{"a", "b", "c", "d", "e"},
+			wantCurrent: 2,
+			upcoming:    "d",
+			wantErr:     true,
+		},
+		{
+			name:        "reorder",
+			current:     1,
+			change:      func(pl *Playlist) error { return pl.Reorder([]int{4, 3, 2, 1, 0}) },
+			paths:       []string{"e", "d", "c", "b", "a"},
+			wantCurrent: 3,
+			upcoming:    "a",
+		},
+		{
+			name:        "reorder with a repeated position",
+			current:     1,
+			change:      func(pl *Playlist) error { return pl.Reorder([]int{0, 0, 2, 3, 4}) },
+			paths:       []string{"a", "b", "c", "d", "e"},
+			wantCurrent: 1,
+			upcoming:    "c",
+			wantErr:     true,
+		},
+		{
+			name:        "reorder with too few positions",
+			current:     1,
+			change:      func(pl *Playlist) error { return pl.Reorder([]int{1, 0}) },
+			paths:       []string{"a", "b", "c", "d", "e"},
+			wantCurrent: 1,
+			upcoming:    "c",
+			wantErr:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pl := testPlaylist("a", "b", "c", "d", "e")
+			if err := pl.SetCurrent(test.current); err != nil {
+				t.Fatal(err)
+			}
+			if err := test.change(pl); (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, test.wantErr)
+			}
+			if paths := playlistPaths(pl); !reflect.DeepEqual(paths, test.paths) {
+				t.Errorf("got entries %v, want %v", paths, test.paths)
+			}
+			if current := pl.CurrentIndex(); current != test.wantCurrent {
+				t.Errorf("got current %d, want %d", current, test.wantCurrent)
+			}
+			if upcoming := upcomingPath(pl); upcoming != test.upcoming {
+				t.Errorf("got upcoming %q, want %q", upcoming, test.upcoming)
+			}
+			// Advance goes where Upcoming said it would.
+			entry, ok := pl.Advance()
+			if ok != (test.upcoming != "") || ok && entry.Path != test.upcoming {
+				t.Errorf("advanced to %q, %v, want %q", entry.Path, ok, test.upcoming)
+			}
+		})
+	}
+}
+
+func TestPlaylistEnds(t *testing.T) {
+	tests := []struct {
+		repeat RepeatMode
+		// the songs Upcoming, Advance, Next and Prev go to from the last one, Prev also from the first one.
+		upcoming, advance, next, prevLast, prevFirst string
+	}{
+		{repeat: RepeatOff, upcoming: "", advance: "", next: "", prevLast: "b", prevFirst: ""},
+		{repeat: RepeatAll, upcoming: "a", advance: "a", next: "a", prevLast: "b", prevFirst: "c"},
+		{repeat: RepeatOne, upcoming: "c", advance: "c", next: "", prevLast: "b", prevFirst: ""},
+	}
+	path := func(entry PlaylistEntry, ok bool) string {
+		if !ok {
+			return ""
+		}
+		return entry.Path
+	}
+	for _, test := range tests {
+		t.Run(test.repeat.String(), func(t *testing.T) {
+			last := func() *Playlist {
+				pl := testPlaylist("a", "b", "c")
+				pl.SetRepeat(test.repeat)
+				pl.SetCurrent(2)
+				return pl
+			}
+			if got := upcomingPath(last()); got != test.upcoming {
+				t.Errorf("Upcoming: got %q, want %q", got, test.upcoming)
+			}
+			pl := last()
+			if got := path(pl.Advance()); got != test.advance {
+				t.Errorf("Advance: got %q, want %q", got, test.advance)
+			}
+			if test.advance == "" && pl.CurrentIndex() != 2 {
+				t.Errorf("Advance at the end moved to %d", pl.CurrentIndex())
+			}
+			if got := path(last().Next()); got != test.next {
+				t.Errorf("Next: got %q, want %q", got, test.next)
+			}
+			if got := path(last().Prev()); got != test.prevLast {
+				t.Errorf("Prev: got %q, want %q", got, test.prevLast)
+			}
+			first := testPlaylist("a", "b", "c")
+			first.SetRepeat(test.repeat)
+			if got := path(first.Prev()); got != test.prevFirst {
+				t.Errorf("Prev from the first song: got %q, want %q", got, test.prevFirst)
+			}
+		})
+	}
+}
+
+func TestPlaylistEmpty(t *testing.T) {
+	pl := testPlaylist()
+	if _, ok := pl.Current(); ok {
+		t.Error("empty playlist has a current song")
+	}
+	for name, move := range map[string]func() (PlaylistEntry, bool){
+		"Next": pl.Next, "Prev": pl.Prev, "Advance": pl.Advance,
+	} {
+		if _, ok := move(); ok {
+			t.Errorf("%s moved in an empty playlist", name)
+		}
+	}
+	if upcoming := upcomingPath(pl); upcoming != "" {
+		t.Errorf("empty playlist has %q upcoming", upcoming)
+	}
+	pl.Add(PlaylistEntry{Path: "a"})
+	if current, ok := pl.Current(); !ok || current.Path != "a" {
+		t.Errorf("got current %q, %v after adding to an empty playlist, want a", current.Path, ok)
+	}
+}
+
+func TestRepeatModeCycle(t *testing.T) {
+	mode := RepeatOff
+	for _, want := range []RepeatMode{RepeatAll, RepeatOne, RepeatOff} {
+		mode = mode.Cycle()
+		if mode != want {
+			t.Fatalf("got %v, want %v", mode, want)
+		}
+	}
+}
+
+// playRound plays from the current song until the playlist runs out or n songs played, returning their paths. The
+// last one played stays current.
+func playRound(pl *Playlist, n int) []string {
+	current, ok := pl.Current()
+	var played []string
+	for ok {
+		played = append(played, current.Path)
+		if len(played) == n {
+			break
+		}
+		current, ok = pl.Next()
+	}
+	return played
+}
+
+// playsOnce fails unless played holds every path once.
+func playsOnce(t *testing.T, played, paths []string) {
+	t.Helper()
+	count := map[string]int{}
+	for _, path := range played {
+		count[path]++
+	}
+	for _, path := range paths {
+		if count[path] != 1 {
+			t.Errorf("%q played %d times in %v", path, count[path], played)
+		}
+	}
+	if len(played) != len(paths) {
+		t.Errorf("played %d songs, want %d: %v", len(played), len(paths), played)
+	}
+}
+
+var shufflePaths = []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+func TestShuffleRounds(t *testing.T) {
+	pl := testPlaylist()
+	pl.SetShuffle(true)
+	pl.SetRepeat(RepeatAll)
+	entries := make([]PlaylistEntry, len(shufflePaths))
+	for i, path := range shufflePaths {
+		entries[i] = PlaylistEntry{Path: path}
+	}
+	pl.Add(entries...)
+	played := playRound(pl, 3*len(shufflePaths))
+	// songs added to an empty queue are shuffled too.
+	if reflect.DeepEqual(played[:len(shufflePaths)], shufflePaths) {
+		t.Errorf("shuffled songs played in order: %v", played)
+	}
+	for round := 0; round < 3; round++ {
+		playsOnce(t, played[round*len(shufflePaths):(round+1)*len(shufflePaths)], shufflePaths)
+	}
+	for i := 1; i < len(played); i++ {
+		if played[i] == played[i-1] {
+			t.Errorf("%q played twice in a row when starting over: %v", played[i], played)
+		}
+	}
+}
+
+func TestShuffleAddMidRound(t *testing.T) {
+	pl := testPlaylist(shufflePaths[:5]...)
+	pl.SetShuffle(true)
+	played := playRound(pl, 2)
+	for _, path := range shufflePaths[5:] {
+		pl.Add(PlaylistEntry{Path: path})
+	}
+	pl.Next()
+	played = append(played, playRound(pl, len(shufflePaths))...)
+	playsOnce(t, played, shufflePaths)
+}
+
+func TestShuffleEnds(t *testing.T) {
+	tests := []struct {
+		repeat RepeatMode
+		// plays is how many songs a round plays before Next runs out, advance whether Advance still goes on after.
+		plays   int
+		advance bool
+	}{
+		{repeat: RepeatOff, plays: len(shufflePaths), advance: false},
+		{repeat: RepeatOne, plays: len(shufflePaths), advance: true},
+		{repeat: RepeatAll, plays: 2 * len(shufflePaths), advance: true},
+	}
+	for _, test := range tests {
+		t.Run(test.repeat.String(), func(t *testing.T) {
+			pl := testPlaylist(shufflePaths...)
+			pl.SetShuffle(true)
+			pl.SetRepeat(test.repeat)
+			played := playRound(pl, 2*len(shufflePaths))
+			if len(played) != test.plays {
+				t.Fatalf("played %d songs, want %d: %v", len(played), test.plays, played)
+			}
+			playsOnce(t, played[:len(shufflePaths)], shufflePaths)
+			last := pl.CurrentIndex()
+			entry, ok := pl.Advance()
+			if ok != test.advance {
+				t.Fatalf("Advance at the end: got %v, want %v", ok, test.advance)
+			}
+			// repeating one song plays it again.
+			if test.repeat == RepeatOne && (pl.CurrentIndex() != last || entry.Path != shufflePaths[last]) {
+				t.Errorf("Advance went to %q, want the same song %q", entry.Path, shufflePaths[last])
+			}
+		})
+	}
+}
+
+func TestToggleShuffleKeepsCurrent(t *testing.T) {
+	pl := testPlaylist(shufflePaths...)
+	pl.SetCurrent(3)
+	pl.SetShuffle(true)
+	if current := pl.CurrentIndex(); current != 3 {
+		t.Fatalf("current went from 3 to %d when shuffling", current)
+	}
+	// the current song starts the new order, so the whole round is still to come.
+	playsOnce(t, playRound(pl, len(shufflePaths)), shufflePaths)
+	pl.SetCurrent(5)
+	pl.SetShuffle(false)
+	if current := pl.CurrentIndex(); current != 5 {
+		t.Fatalf("current went from 5 to %d when not shuffling", current)
+	}
+	if upcoming := upcomingPath(pl); upcoming != shufflePaths[6] {
+		t.Errorf("got upcoming %q after shuffling off, want %q", upcoming, shufflePaths[6])
+	}
+}
+
+func TestShuffleRemoveCurrent(t *testing.T) {
+	pl := testPlaylist(shufflePaths...)
+	pl.SetShuffle(true)
+	played := playRound(pl, 3)
+	pl.Remove(pl.CurrentIndex())
+	// the song after the removed one in play order comes next, no song is skipped.
+	entry, ok := pl.Advance()
+	for ok {
+		played = append(played, entry.Path)
+		entry, ok = pl.Next()
+	}
+	playsOnce(t, played, shufflePaths)
+}
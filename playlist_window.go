@@ -0,0 +1,597 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// playlistWidth and playlistHeight are the size of the playlist editor, as tall as two main windows.
+const playlistWidth = 275
+const playlistHeight = 232
+
+// playlistListArea is where the entries are drawn, between the tiles of the frame.
+var playlistListArea = image.Rect(12, 20, 255, 194)
+
+const playlistRowHeight = 13
+const playlistFontSize = 9
+
+// doubleClickTime is how close two clicks on an entry have to be to play it.
+const doubleClickTime = 400 * time.Millisecond
+
+// playlistView draws the entries of the playlist in the editor and keeps which ones are selected. It is rendered
+// from the player loop when songs change as well as from the UI, mu guards everything below it.
+type playlistView struct {
+	area     image.Rectangle
+	playlist *Playlist
+	mu       sync.Mutex
+	style    PlaylistStyle
+	// face can't be used concurrently.
+	face font.Face
+	// first is the entry shown in the top row.
+	first    int
+	selected map[int]bool
+	// anchor is where shift+click selections start from.
+	anchor    int
+	lastClick time.Time
+	lastRow   int
+	// play is called when an entry is double clicked.
+	play func(i int)
+	buf  *image.RGBA
+}
+
+// rows is how many entries fit in the view.
+func (v *playlistView) rows() int {
+	return v.area.Dy() / playlistRowHeight
+}
+
+// maxFirst is the furthest the view can be scrolled.
+func (v *playlistView) maxFirst() int {
+	return max(0, v.playlist.Len()-v.rows())
+}
+
+func (v *playlistView) scrollTo(first int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.first = max(0, min(first, v.maxFirst()))
+	v.renderLocked()
+}
+
+// firstRow is the entry shown in the top row.
+func (v *playlistView) firstRow() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.first
+}
+
+// setStyle changes the colors and font of the list, as skins do.
+func (v *playlistView) setStyle(style PlaylistStyle, face font.Face) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.style, v.face = style, face
+}
+
+func (v *playlistView) isSelected(i int) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.selected[i]
+}
+
+// selectWhere selects the entries selected returns true for, and only them. It is told whether they were.
+func (v *playlistView) selectWhere(selected func(i int, was bool) bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	chosen := map[int]bool{}
+	for i := 0; i < v.playlist.Len(); i++ {
+		if selected(i, v.selected[i]) {
+			chosen[i] = true
+		}
+	}
+	v.selected = chosen
+}
+
+// render draws the visible entries into buf, each row has the number and title of the entry on the left and its
+// length on the right.
+func (v *playlistView) render() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.renderLocked()
+}
+
+func (v *playlistView) renderLocked() {
+	if v.buf == nil {
+		v.buf = image.NewRGBA(image.Rect(0, 0, v.area.Dx(), v.area.Dy()))
+	}
+	draw.Draw(v.buf, v.buf.Bounds(), image.NewUniform(v.style.NormalBG), image.Point{}, draw.Src)
+	entries := v.playlist.Entries()
+	current := v.playlist.CurrentIndex()
+	v.first = max(0, min(v.first, v.maxFirst()))
+	ascent := v.face.Metrics().Ascent.Ceil()
+	for row := 0; row < v.rows() && v.first+row < len(entries); row++ {
+		i := v.first + row
+		top := row * playlistRowHeight
+		rowRect := image.Rect(0, top, v.area.Dx(), top+playlistRowHeight)
+		if v.selected[i] {
+			draw.Draw(v.buf, rowRect, image.NewUniform(v.style.SelectedBG), image.Point{}, draw.Src)
+		}
+		textColor := v.style.Normal
+		if i == current {
+			textColor = v.style.Current
+		}
+		d := &font.Drawer{Face: v.face, Src: image.NewUniform(textColor)}
+		right := v.area.Dx() - 2
+		if length := entries[i].Length; length > 0 {
+			text := formatLength(length)
+			d.Dst = v.buf
+			right -= d.MeasureString(text).Ceil()
+			d.Dot = fixed.P(right, top+ascent+(playlistRowHeight-ascent)/2)
+			d.DrawString(text)
+			right -= 4
+		}
+		// the title is cut where the length begins.
+		d.Dst = v.buf.SubImage(image.Rect(0, top, right, top+playlistRowHeight)).(*image.RGBA)
+		d.Dot = fixed.P(2, top+ascent+(playlistRowHeight-ascent)/2)
+		d.DrawString(fmt.Sprintf("%d. %s", i+1, entries[i].DisplayTitle()))
+	}
+}
+
+func (v *playlistView) DrawAtPosition(x, y int) color.Color {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.buf == nil || !image.Pt(x, y).In(v.area) {
+		return nil
+	}
+	return v.buf.At(x-v.area.Min.X, y-v.area.Min.Y)
+}
+
+// press selects entries like file managers do: a click selects one, ctrl toggles one and shift selects a range. A
+// double click plays the entry. It reports whether the press was on the list.
+func (v *playlistView) press(x, y int, modifier fyne.KeyModifier) bool {
+	if !image.Pt(x, y).In(v.area) {
+		return false
+	}
+	v.mu.Lock()
+	i := v.first + (y-v.area.Min.Y)/playlistRowHeight
+	if i >= v.playlist.Len() {
+		v.selected = map[int]bool{}
+		v.renderLocked()
+		v.mu.Unlock()
+		return true
+	}
+	doubleClick := i == v.lastRow && time.Since(v.lastClick) < doubleClickTime
+	v.lastRow, v.lastClick = i, time.Now()
+	switch {
+	case modifier&fyne.KeyModifierShift != 0:
+		v.selected = map[int]bool{}
+		for j := min(v.anchor, i); j <= max(v.anchor, i); j++ {
+			v.selected[j] = true
+		}
+	case modifier&fyne.KeyModifierShortcutDefault != 0:
+		v.selected[i] = !v.selected[i]
+		v.anchor = i
+	default:
+		v.selected = map[int]bool{i: true}
+		v.anchor = i
+	}
+	v.renderLocked()
+	v.mu.Unlock()
+	if doubleClick && v.play != nil {
+		v.play(i)
+	}
+	return true
+}
+
+// selection returns the selected entries, in order.
+func (v *playlistView) selection() []int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var selection []int
+	for i := 0; i < v.playlist.Len(); i++ {
+		if v.selected[i] {
+			selection = append(selection, i)
+		}
+	}
+	return selection
+}
+
+// playlistFace loads the font the skin asks for from the system fonts, or the one of the fyne theme when it can't
+// be found.
+func playlistFace(name string) (font.Face, error) {
+	data := theme.DefaultTextFont().Content()
+	if path := findSystemFont(name); path != "" {
+		if raw, err := os.ReadFile(path); err == nil {
+			if _, err := opentype.Parse(raw); err == nil {
+				data = raw
+			}
+		}
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing playlist font: %w", err)
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{
+		Size:    playlistFontSize,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// fontDirs are where fonts are usually installed.
+var fontDirs = []string{
+	"/usr/share/fonts",
+	"/usr/local/share/fonts",
+	"~/.fonts",
+	"~/.local/share/fonts",
+	"/Library/Fonts",
+	"/System/Library/Fonts",
+	`C:\Windows\Fonts`,
+}
+
+// findSystemFont returns the path of the TrueType or OpenType font file named after a font, ignoring case and
+// spaces, as in arial.ttf for Arial. It returns "" if there is none.
+func findSystemFont(name string) string {
+	want := strings.ToLower(strings.ReplaceAll(name, " ", ""))
+	home, _ := os.UserHomeDir()
+	for _, dir := range fontDirs {
+		if strings.HasPrefix(dir, "~") {
+			if home == "" {
+				continue
+			}
+			dir = filepath.Join(home, dir[1:])
+		}
+		var found string
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			base := strings.ToLower(strings.ReplaceAll(strings.TrimSuffix(d.Name(), filepath.Ext(path)), " ", ""))
+			if (ext == ".ttf" || ext == ".otf") && base == want {
+				found = path
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if found != "" {
+			return found
+		}
+	}
+	return ""
+}
+
+// playlistWindow is the playlist editor, built from pledit.bmp and colored after pledit.txt.
+type playlistWindow struct {
+	fyne.Window
+	player *Player
+	stack  *SpriteStack
+	view   *playlistView
+	widget *bgWidget
+}
+
+// newPlaylistWindow builds the playlist editor, it starts hidden. closed is called when the window is closed from its
+// own close button.
+func newPlaylistWindow(a fyne.App, skin *Skin, skins *skinSwitcher, player *Player, closed func()) (*playlistWindow, error) {
+	w := a.NewWindow("Playlist Editor")
+	w.SetPadded(false)
+	w.Resize(fyne.Size{
+		Width:  playlistWidth * scaleFactor,
+		Height: playlistHeight * scaleFactor,
+	})
+
+	stack, err := stackFromFromDefinitions(skin, "./pledit_sprites.json")
+	if err != nil {
+		return nil, fmt.Errorf("loading playlist stack: %w", err)
+	}
+	style := skin.PlaylistStyle()
+	face, err := playlistFace(style.Font)
+	if err != nil {
+		return nil, err
+	}
+	pw := &playlistWindow{
+		Window: w,
+		player: player,
+		stack:  stack,
+		view: &playlistView{
+			area:     playlistListArea,
+			style:    style,
+			face:     face,
+			playlist: player.Playlist(),
+			selected: map[int]bool{},
+			play: func(i int) {
+				if err := player.PlayEntry(i); err != nil {
+					dialog.ShowError(err, w)
+				}
+			},
+		},
+	}
+	pw.view.render()
+	pw.widget = newBgWidget(&Background{
+		stack:     stack,
+		textLayer: &TextLayer{},
+		overlays:  []layer{pw.view},
+		size:      image.Pt(playlistWidth, playlistHeight),
+	})
+	pw.widget.pressed = pw.view.press
+	pw.widget.cursors = loadWindowCursors(skin, "pnormal.cur", playlistCursors)
+	pw.widget.scrolled = func(dy float32) {
+		// a notch of the wheel scrolls a few entries.
+		rows := 3
+		if dy > 0 {
+			rows = -rows
+		}
+		pw.view.scrollTo(pw.view.firstRow() + rows)
+		pw.syncScroll()
+	}
+	w.SetContent(pw.widget)
+	skins.add(func(skin *Skin) (func(), error) {
+		fileCache, err := stack.loadImages(skin)
+		if err != nil {
+			return nil, fmt.Errorf("loading playlist stack: %w", err)
+		}
+		style := skin.PlaylistStyle()
+		face, err := playlistFace(style.Font)
+		if err != nil {
+			return nil, err
+		}
+		cursors := loadWindowCursors(skin, "pnormal.cur", playlistCursors)
+		return func() {
+			stack.useImages(skin, fileCache)
+			pw.view.setStyle(style, face)
+			pw.widget.cursors = cursors
+			pw.Refresh()
+		}, nil
+	})
+
+	scrolled := func() error {
+		pos := stack.FindByID("pl.scroll").DraggablePosition()
+		pw.view.scrollTo(int(pos*float64(pw.view.maxFirst()) + 0.5))
+		pw.widget.Refresh()
+		return nil
+	}
+	stack.register("PL_SCROLL", scrolled)
+	stack.registerDrag("PL_SCROLL", scrolled)
+	stack.register("PL_ADD", pw.menuAdd)
+	stack.register("PL_REM", pw.menuRemove)
+	stack.register("PL_SEL", pw.menuSelect)
+	stack.register("PL_MISC", pw.menuMisc)
+	stack.register("PL_LIST", pw.menuList)
+
+	hide := func() {
+		w.Hide()
+		closed()
+	}
+	stack.register("PL_CLOSE", func() error {
+		hide()
+		return nil
+	})
+	w.SetCloseIntercept(hide)
+	return pw, nil
+}
+
+// Refresh redraws the list, it is called when the playlist or the current song change.
+func (pw *playlistWindow) Refresh() {
+	pw.view.render()
+	pw.syncScroll()
+	pw.widget.Refresh()
+}
+
+// syncScroll moves the scroll handle to where the view is.
+func (pw *playlistWindow) syncScroll() {
+	if maxFirst := pw.view.maxFirst(); maxFirst > 0 {
+		pw.stack.FindByID("pl.scroll").DraggableSeek(float64(pw.view.firstRow()) / float64(maxFirst))
+	} else {
+		pw.stack.FindByID("pl.scroll").DraggableSeek(0)
+	}
+}
+
+// changed is called after the entries of the playlist changed, the selection doesn't point to the same entries
+// anymore.
+func (pw *playlistWindow) changed() {
+	pw.view.selectWhere(func(int, bool) bool { return false })
+	pw.Refresh()
+}
+
+func (pw *playlistWindow) showError(err error) {
+	if err != nil {
+		dialog.ShowError(err, pw.Window)
+	}
+}
+
+// showMenu opens the menu of one of the buttons at the bottom, right over it like Winamp's.
+func (pw *playlistWindow) showMenu(buttonID string, items ...*fyne.MenuItem) error {
+	button := pw.stack.FindByID(buttonID)
+	menu := fyne.NewMenu("", items...)
+	size := widget.NewPopUpMenu(menu, pw.Canvas()).MinSize()
+	pos := fyne.NewPos(
+		float32(button.AbsolutePositionX*scaleFactor),
+		float32((button.AbsolutePositionY+button.Image.SpriteHeight)*scaleFactor)-size.Height)
+	widget.ShowPopUpMenuAtPosition(menu, pw.Canvas(), pos)
+	return nil
+}
+
+func (pw *playlistWindow) menuAdd() error {
+	return pw.showMenu("pl.add",
+		fyne.NewMenuItem("Add file...", func() {
+			fileOpen := dialog.NewFileOpen(func(uri fyne.URIReadCloser, err error) {
+				if err != nil || uri == nil {
+					return
+				}
+				uri.Close()
+				pw.player.Playlist().Add(PlaylistEntry{Path: uri.URI().Path()})
+				pw.changed()
+			}, pw.Window)
+			fileOpen.SetFilter(storage.NewExtensionFileFilter(supportedExtensions()))
+			fileOpen.Show()
+		}),
+		fyne.NewMenuItem("Add folder...", func() {
+			dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+				if err != nil || uri == nil {
+					return
+				}
+				entries, err := songsInDir(uri.Path())
+				if err != nil {
+					pw.showError(err)
+					return
+				}
+				pw.player.Playlist().Add(entries...)
+				pw.changed()
+			}, pw.Window)
+		}))
+}
+
+// removeWhere takes out of the playlist the entries remove returns true for, from the last so indexes hold.
+func (pw *playlistWindow) removeWhere(remove func(i int, entry PlaylistEntry) bool) {
+	playlist := pw.player.Playlist()
+	entries := playlist.Entries()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if remove(i, entries[i]) {
+			pw.showError(playlist.Remove(i))
+		}
+	}
+	pw.changed()
+}
+
+func (pw *playlistWindow) menuRemove() error {
+	return pw.showMenu("pl.rem",
+		fyne.NewMenuItem("Remove selected", func() {
+			pw.removeWhere(func(i int, _ PlaylistEntry) bool { return pw.view.isSelected(i) })
+		}),
+		fyne.NewMenuItem("Crop selection", func() {
+			pw.removeWhere(func(i int, _ PlaylistEntry) bool { return !pw.view.isSelected(i) })
+		}),
+		fyne.NewMenuItem("Remove dead files", func() {
+			pw.removeWhere(func(_ int, entry PlaylistEntry) bool {
+				_, err := os.Stat(entry.Path)
+				return err != nil
+			})
+		}),
+		fyne.NewMenuItem("Remove all", func() {
+			pw.player.Playlist().Clear()
+			pw.changed()
+		}))
+}
+
+func (pw *playlistWindow) menuSelect() error {
+	selectWhere := func(selected func(i int, was bool) bool) {
+		pw.view.selectWhere(selected)
+		pw.Refresh()
+	}
+	return pw.showMenu("pl.sel",
+		fyne.NewMenuItem("Select all", func() {
+			selectWhere(func(int, bool) bool { return true })
+		}),
+		fyne.NewMenuItem("Select none", func() {
+			selectWhere(func(int, bool) bool { return false })
+		}),
+		fyne.NewMenuItem("Invert selection", func() {
+			selectWhere(func(_ int, was bool) bool { return !was })
+		}))
+}
+
+// sortBy reorders the playlist by the key of each entry, entries with equal keys keep their order.
+func (pw *playlistWindow) sortBy(key func(entry PlaylistEntry) string) {
+	entries := pw.player.Playlist().Entries()
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return strings.ToLower(key(entries[order[a]])) < strings.ToLower(key(entries[order[b]]))
+	})
+	pw.reorder(order)
+}
+
+func (pw *playlistWindow) reorder(order []int) {
+	pw.showError(pw.player.Playlist().Reorder(order))
+	pw.changed()
+}
+
+func (pw *playlistWindow) menuMisc() error {
+	sortItem := fyne.NewMenuItem("Sort list", nil)
+	sortItem.ChildMenu = fyne.NewMenu("",
+		fyne.NewMenuItem("Sort by title", func() {
+			pw.sortBy(PlaylistEntry.DisplayTitle)
+		}),
+		fyne.NewMenuItem("Sort by filename", func() {
+			pw.sortBy(func(entry PlaylistEntry) string { return filepath.Base(entry.Path) })
+		}),
+		fyne.NewMenuItem("Sort by path and filename", func() {
+			pw.sortBy(func(entry PlaylistEntry) string { return entry.Path })
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Reverse list", func() {
+			n := pw.player.Playlist().Len()
+			order := make([]int, n)
+			for i := range order {
+				order[i] = n - 1 - i
+			}
+			pw.reorder(order)
+		}),
+		fyne.NewMenuItem("Randomize list", func() {
+			pw.reorder(rand.Perm(pw.player.Playlist().Len()))
+		}))
+	return pw.showMenu("pl.misc",
+		sortItem,
+		fyne.NewMenuItem("File info...", func() {
+			selection := pw.view.selection()
+			if len(selection) == 0 {
+				return
+			}
+			entry, err := pw.player.Playlist().Entry(selection[0])
+			if err != nil {
+				pw.showError(err)
+				return
+			}
+			info := fmt.Sprintf("Title: %s\nPath: %s", entry.DisplayTitle(), entry.Path)
+			if entry.Length > 0 {
+				info += fmt.Sprintf("\nLength: %s", entry.Length.Round(time.Second))
+			}
+			dialog.ShowInformation("File info", info, pw.Window)
+		}))
+}
+
+func (pw *playlistWindow) menuList() error {
+	return pw.showMenu("pl.list",
+		fyne.NewMenuItem("New list", func() {
+			pw.showError(pw.player.LoadPlaylist(nil))
+			pw.changed()
+		}),
+		fyne.NewMenuItem("Save list...", func() {
+			showSavePlaylist(pw.Window, pw.player)
+		}),
+		fyne.NewMenuItem("Load list...", func() {
+			fileOpen := dialog.NewFileOpen(func(uri fyne.URIReadCloser, err error) {
+				if err != nil || uri == nil {
+					return
+				}
+				uri.Close()
+				entries, err := loadPlaylistFile(uri.URI().Path())
+				if err != nil {
+					pw.showError(err)
+					return
+				}
+				pw.showError(pw.player.LoadPlaylist(entries))
+				pw.changed()
+			}, pw.Window)
+			fileOpen.SetFilter(storage.NewExtensionFileFilter(playlistExtensions()))
+			fileOpen.Show()
+		}))
+}
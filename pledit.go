@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PlaylistStyle are the colors and font of the playlist editor, skins set them in pledit.txt:
+//
+//	[Text]
+//	Normal=#00FF00
+//	Current=#FFFFFF
+//	NormalBG=#000000
+//	SelectedBG=#0000C6
+//	Font=Arial
+type PlaylistStyle struct {
+	// Normal is the color of the entries and Current the one of the song playing.
+	Normal, Current color.RGBA
+	// NormalBG is the background of the list and SelectedBG the one of the selected entries.
+	NormalBG, SelectedBG color.RGBA
+	Font                 string
+}
+
+// defaultPlaylistStyle is the one of the Winamp base skin, used for anything pledit.txt doesn't say.
+var defaultPlaylistStyle = PlaylistStyle{
+	Normal:     color.RGBA{R: 0x00, G: 0xff, B: 0x00, A: 0xff},
+	Current:    color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	NormalBG:   color.RGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xff},
+	SelectedBG: color.RGBA{R: 0x00, G: 0x00, B: 0xc6, A: 0xff},
+	Font:       "Arial",
+}
+
+// PlaylistStyle returns the style in the pledit.txt of the skin, the default one if it has none.
+func (s *Skin) PlaylistStyle() PlaylistStyle {
+	f, err := s.Open("pledit.txt")
+	if err != nil {
+		return defaultPlaylistStyle
+	}
+	defer f.Close()
+	return parsePlaylistStyle(f)
+}
+
+// parsePlaylistStyle reads pledit.txt, skins in the wild are sloppy so unknown keys, sections and malformed values
+// are ignored.
+func parsePlaylistStyle(r io.Reader) PlaylistStyle {
+	style := defaultPlaylistStyle
+	inText := true
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inText = strings.EqualFold(strings.Trim(line, "[] "), "text")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inText || !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		var dst *color.RGBA
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "normal":
+			dst = &style.Normal
+		case "current":
+			dst = &style.Current
+		case "normalbg":
+			dst = &style.NormalBG
+		case "selectedbg":
+			dst = &style.SelectedBG
+		case "font":
+			if value != "" {
+				style.Font = value
+			}
+			continue
+		default:
+			continue
+		}
+		if c, ok := parseHexColor(value); ok {
+			*dst = c
+		}
+	}
+	return style
+}
+
+// parseHexColor parses colors written as #RRGGBB, the # is often missing and there can be junk after them.
+func parseHexColor(value string) (color.RGBA, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "#")
+	if len(value) < 6 {
+		return color.RGBA{}, false
+	}
+	rgb, err := strconv.ParseUint(value[:6], 16, 32)
+	if err != nil {
+		return color.RGBA{}, false
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}, true
+}
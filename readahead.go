@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// readAheadSize bounds how much of an audio file is held in memory at any time.
+const readAheadSize = 64 * 1024
+
+// readAheadReader buffers reads from an io.ReadSeeker like bufio.Reader does, but it can also seek, which the
+// decoders need to find lengths and seek points. Seeks that land inside the buffer don't touch the source.
+type readAheadReader struct {
+	src io.ReadSeeker
+	buf []byte
+	// buf[r:w] is what has been read from src but not handed out yet.
+	r, w int
+	// srcPos is the offset in src right after buf[w-1].
+	srcPos int64
+}
+
+func newReadAheadReader(src io.ReadSeeker) *readAheadReader {
+	return &readAheadReader{
+		src: src,
+		buf: make([]byte, readAheadSize),
+	}
+}
+
+func (b *readAheadReader) Read(p []byte) (int, error) {
+	if b.r == b.w {
+		// big reads go straight to the source, there is no point in copying them twice.
+		if len(p) >= len(b.buf) {
+			n, err := b.src.Read(p)
+			b.srcPos += int64(n)
+			b.r, b.w = 0, 0
+			return n, err
+		}
+		n, err := b.src.Read(b.buf)
+		b.srcPos += int64(n)
+		b.r, b.w = 0, n
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, b.buf[b.r:b.w])
+	b.r += n
+	return n, nil
+}
+
+func (b *readAheadReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = b.srcPos - int64(b.w-b.r) + offset
+	case io.SeekEnd:
+		// we don't know where the end is, let the source tell us.
+		n, err := b.src.Seek(offset, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		b.r, b.w = 0, 0
+		b.srcPos = n
+		return n, nil
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, fmt.Errorf("negative position %d", abs)
+	}
+	bufStart := b.srcPos - int64(b.w)
+	if abs >= bufStart && abs <= b.srcPos {
+		b.r = int(abs - bufStart)
+		return abs, nil
+	}
+	n, err := b.src.Seek(abs, io.SeekStart)
+	if err != nil {
+		// the source didn't move, neither does what we have buffered of it.
+		return 0, err
+	}
+	b.r, b.w = 0, 0
+	b.srcPos = n
+	return n, nil
+}
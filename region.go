@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Region is the shape of a window as skins describe it in region.txt, a set of polygons. Points inside any of them
+// belong to the window.
+type Region struct {
+	polygons [][]image.Point
+}
+
+// the sections of region.txt, one per window and state.
+const (
+	regionNormal      = "normal"
+	regionWindowShade = "windowshade"
+	regionEqualizer   = "equalizer"
+	regionEqualizerWS = "equalizerws"
+)
+
+// Contains tells if the pixel at x, y is inside the region. Polygons go around the pixels they hold, as in
+// 0,0 275,0 275,116 0,116 for the whole main window, so the test is done on the center of the pixel.
+func (r *Region) Contains(x, y int) bool {
+	px, py := float64(x)+0.5, float64(y)+0.5
+	for _, polygon := range r.polygons {
+		inside := false
+		for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+			a, b := polygon[i], polygon[j]
+			if (float64(a.Y) > py) != (float64(b.Y) > py) &&
+				px < float64(b.X-a.X)*(py-float64(a.Y))/float64(b.Y-a.Y)+float64(a.X) {
+				inside = !inside
+			}
+		}
+		if inside {
+			return true
+		}
+	}
+	return false
+}
+
+// Mask returns the region as an alpha mask over bounds, opaque inside it.
+func (r *Region) Mask(bounds image.Rectangle) *image.Alpha {
+	mask := image.NewAlpha(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r.Contains(x, y) {
+				mask.Pix[mask.PixOffset(x, y)] = 0xff
+			}
+		}
+	}
+	return mask
+}
+
+// Regions returns the regions of the region.txt of the skin by lowercase section name. Windows without one are
+// rectangles, as are all of them when the skin has no region.txt.
+func (s *Skin) Regions() map[string]*Region {
+	f, err := s.Open("region.txt")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return parseRegions(f)
+}
+
+// parseRegions reads region.txt, each section has the number of points of each polygon and then all of them:
+//
+//	[Normal]
+//	NumPoints=4,4
+//	PointList=0,0, 275,0, 275,14, 0,14,  0,15, 275,15, 275,116, 0,116
+//
+// Numbers are separated by commas, spaces or both. Polygons the point list falls short of and the ones with less
+// than 3 points are dropped, as are sections left without polygons.
+func parseRegions(r io.Reader) map[string]*Region {
+	counts := map[string][]int{}
+	points := map[string][]int{}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[] "))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section == "" {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "numpoints":
+			counts[section] = regionNumbers(value)
+		case "pointlist":
+			points[section] = regionNumbers(value)
+		}
+	}
+	regions := map[string]*Region{}
+	for section, counts := range counts {
+		coords := points[section]
+		region := &Region{}
+		for _, count := range counts {
+			if count < 0 || count > len(coords)/2 {
+				break
+			}
+			if count >= 3 {
+				polygon := make([]image.Point, count)
+				for i := range polygon {
+					polygon[i] = image.Pt(coords[2*i], coords[2*i+1])
+				}
+				region.polygons = append(region.polygons, polygon)
+			}
+			coords = coords[count*2:]
+		}
+		if len(region.polygons) > 0 {
+			regions[section] = region
+		}
+	}
+	return regions
+}
+
+// regionNumbers returns the numbers in a list separated by commas and spaces, junk in between is skipped.
+func regionNumbers(list string) []int {
+	var numbers []int
+	for _, field := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		if n, err := strconv.Atoi(field); err == nil {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
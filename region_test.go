@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRegions(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		regions map[string][][]image.Point
+	}{
+		{
+			name: "two polygons",
+			data: "[Normal]\nNumPoints=4,4\nPointList=0,0, 275,0, 275,14, 0,14,  0,15, 275,15, 275,116, 0,116\n",
+			regions: map[string][][]image.Point{
+				regionNormal: {
+					{{0, 0}, {275, 0}, {275, 14}, {0, 14}},
+					{{0, 15}, {275, 15}, {275, 116}, {0, 116}},
+				},
+			},
+		},
+		{
+			name: "sections, case and separators",
+			data: "; comment\r\n[WindowShade]\r\nnumpoints = 3\r\npointlist = 0 0\t10 0 , 0 10\r\n[Equalizer]\r\nNumPoints=3\r\n",
+			regions: map[string][][]image.Point{
+				regionWindowShade: {{{0, 0}, {10, 0}, {0, 10}}},
+			},
+		},
+		{
+			name: "junk between numbers",
+			data: "[Normal]\nNumPoints=3\nPointList=0,0,x,10,0,,0,10\n",
+			regions: map[string][][]image.Point{
+				regionNormal: {{{0, 0}, {10, 0}, {0, 10}}},
+			},
+		},
+		{
+			name: "too few points",
+			data: "[Normal]\nNumPoints=2,3,4\nPointList=0,0,1,1, 0,0,10,0,0,10, 0,0,10,0\n",
+			regions: map[string][][]image.Point{
+				regionNormal: {{{0, 0}, {10, 0}, {0, 10}}},
+			},
+		},
+		{name: "negative count", data: "[Normal]\nNumPoints=-3,3\nPointList=0,0,10,0,0,10\n"},
+		{name: "huge count", data: "[Normal]\nNumPoints=9223372036854775807\nPointList=0,0,10,0,0,10\n"},
+		{name: "outside a section", data: "NumPoints=3\nPointList=0,0,10,0,0,10\n"},
+		{name: "empty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			regions := parseRegions(strings.NewReader(test.data))
+			got := map[string][][]image.Point{}
+			for section, region := range regions {
+				got[section] = region.polygons
+			}
+			want := test.regions
+			if want == nil {
+				want = map[string][][]image.Point{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// TestParseRegionsTruncated parses every prefix of a region.txt, none should panic.
+func TestParseRegionsTruncated(t *testing.T) {
+	data := "[Normal]\nNumPoints=4,4\nPointList=0,0, 275,0, 275,14, 0,14,  0,15, 275,15, 275,116, 0,116\n"
+	for n := range data {
+		parseRegions(strings.NewReader(data[:n]))
+	}
+}
+
+func TestRegionContains(t *testing.T) {
+	// an L shape, the notch at the top right is outside.
+	region := &Region{polygons: [][]image.Point{
+		{{0, 0}, {10, 0}, {10, 10}, {0, 10}},
+		{{0, 10}, {20, 10}, {20, 20}, {0, 20}},
+	}}
+	for _, test := range []struct {
+		x, y   int
+		inside bool
+	}{
+		{0, 0, true},
+		{9, 9, true},
+		{10, 0, false},
+		{15, 5, false},
+		{19, 19, true},
+		{20, 19, false},
+		{-1, 5, false},
+	} {
+		if got := region.Contains(test.x, test.y); got != test.inside {
+			t.Errorf("Contains(%d, %d) = %v, want %v", test.x, test.y, got, test.inside)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// ReplayGainMode is which of the ReplayGain values of songs sets their volume.
+type ReplayGainMode int
+
+const (
+	ReplayGainOff ReplayGainMode = iota
+	// ReplayGainTrack makes every song as loud as any other.
+	ReplayGainTrack
+	// ReplayGainAlbum keeps the differences between the songs of an album, as they were mastered.
+	ReplayGainAlbum
+)
+
+func (m ReplayGainMode) String() string {
+	switch m {
+	case ReplayGainTrack:
+		return "track"
+	case ReplayGainAlbum:
+		return "album"
+	}
+	return "off"
+}
+
+// Set parses the names returned by String, so the mode can be a flag.
+func (m *ReplayGainMode) Set(name string) error {
+	switch name {
+	case "off":
+		*m = ReplayGainOff
+	case "track":
+		*m = ReplayGainTrack
+	case "album":
+		*m = ReplayGainAlbum
+	default:
+		return fmt.Errorf("unknown ReplayGain mode %q, expected track, album or off", name)
+	}
+	return nil
+}
+
+// scale is what samples are multiplied by in mode. Songs missing the gain asked for use the other one, and the gain
+// is lowered as needed for the peak to not clip.
+func (rg ReplayGain) scale(mode ReplayGainMode) float64 {
+	var gain, peak float64
+	switch {
+	case mode == ReplayGainOff:
+		return 1
+	case rg.HasAlbum && (mode == ReplayGainAlbum || !rg.HasTrack):
+		gain, peak = rg.AlbumGain, rg.AlbumPeak
+	case rg.HasTrack:
+		gain, peak = rg.TrackGain, rg.TrackPeak
+	default:
+		return 1
+	}
+	scale := math.Pow(10, gain/20)
+	if peak > 0 && scale*peak > 1 {
+		scale = 1 / peak
+	}
+	return scale
+}
+
+// replayGainRamp is how much the scale can change from a frame to the next, so changing it doesn't click.
+const replayGainRamp = 1.0 / (sampleRate / 20)
+
+// replayGainSource sets the volume of a track, it reads the PCM of the track in the output format. The values can
+// come after playback started, when the track had none in its tags and had to be analyzed.
+type replayGainSource struct {
+	src io.ReadSeeker
+	mu  sync.Mutex
+	rg  ReplayGain
+	// mode is the one of the stream, set when the track enters it.
+	mode ReplayGainMode
+	// scale is what is applied now, it moves towards target once the track started playing.
+	scale, target float64
+	started       bool
+}
+
+func newReplayGainSource(src io.ReadSeeker, rg ReplayGain) *replayGainSource {
+	return &replayGainSource{src: src, rg: rg, scale: 1, target: 1}
+}
+
+func (g *replayGainSource) setMode(mode ReplayGainMode) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mode = mode
+	g.retarget()
+}
+
+// setValues replaces the values of the tags with the ones measured.
+func (g *replayGainSource) setValues(rg ReplayGain) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rg = rg
+	g.retarget()
+}
+
+func (g *replayGainSource) retarget() {
+	g.target = g.rg.scale(g.mode)
+	if !g.started {
+		g.scale = g.target
+	}
+}
+
+func (g *replayGainSource) Read(p []byte) (int, error) {
+	n, err := g.src.Read(p)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.started = g.started || n > 0
+	if g.scale == 1 && g.target == 1 {
+		return n, err
+	}
+	for off := 0; off+bytesPerSample <= n; off += bytesPerSample {
+		// both sides of a frame get the same scale
+		if off%outputFrameSize == 0 && g.scale != g.target {
+			g.scale += math.Max(-replayGainRamp, math.Min(replayGainRamp, g.target-g.scale))
+		}
+		v := float64(int16(binary.LittleEndian.Uint16(p[off:]))) * g.scale
+		binary.LittleEndian.PutUint16(p[off:], uint16(clampSample(v)))
+	}
+	return n, err
+}
+
+func (g *replayGainSource) Seek(offset int64, whence int) (int64, error) {
+	return g.src.Seek(offset, whence)
+}
+
+// setReplayGain changes the mode of every track in the stream, those entering it later get it too.
+func (s *stream) setReplayGain(mode ReplayGainMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replayGain = mode
+	tracks := make([]*track, 0, len(s.previous)+3)
+	tracks = append(append(tracks, s.previous...), s.fadeOut, s.current, s.next)
+	for _, t := range tracks {
+		if t != nil {
+			t.gain.setMode(mode)
+		}
+	}
+}
+
+func (s *stream) replayGainMode() ReplayGainMode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replayGain
+}
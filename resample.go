@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// outputChannels is the channel count of the oto context, everything is converted to stereo before playing.
+const outputChannels = 2
+const outputFrameSize = outputChannels * bytesPerSample
+
+// resampleChunkFrames is how many output frames are produced at a time.
+const resampleChunkFrames = 1024
+
+// resampler converts the PCM of a Decoder into the format of the oto context, stereo at sampleRate, by linear
+// interpolation between source frames.
+type resampler struct {
+	decoder  Decoder
+	src      *bufio.Reader
+	channels int
+	// step is how many source frames we advance per output frame.
+	step float64
+	// pos is the position of the next output frame between prev (0) and next (1).
+	pos      float64
+	prev     [outputChannels]float64
+	next     [outputChannels]float64
+	srcFrame []byte
+	started  bool
+	pcm      pcmBuffer
+}
+
+// newResampler returns a reader yielding the audio of d as the oto context expects it, d is returned as is if it is
+// already in that format.
+func newResampler(d Decoder) io.ReadSeeker {
+	if d.SampleRate() == sampleRate && d.ChannelCount() == outputChannels {
+		return d
+	}
+	return &resampler{
+		decoder:  d,
+		src:      bufio.NewReader(d),
+		channels: d.ChannelCount(),
+		step:     float64(d.SampleRate()) / sampleRate,
+		srcFrame: make([]byte, d.ChannelCount()*bytesPerSample),
+	}
+}
+
+// readFrame reads one frame from the source into dst, mono is copied to both sides and anything with more than two
+// channels keeps only the front left and right ones, which come first in every format we decode.
+func (r *resampler) readFrame(dst *[outputChannels]float64) error {
+	if _, err := io.ReadFull(r.src, r.srcFrame); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return io.EOF
+		}
+		return err
+	}
+	for ch := range dst {
+		srcCh := ch
+		if srcCh >= r.channels {
+			srcCh = r.channels - 1
+		}
+		dst[ch] = float64(int16(binary.LittleEndian.Uint16(r.srcFrame[srcCh*bytesPerSample:])))
+	}
+	return nil
+}
+
+func (r *resampler) Read(p []byte) (int, error) {
+	return r.pcm.read(p, r.fill)
+}
+
+// Seek takes offsets in the output PCM and moves the source to the matching frame.
+func (r *resampler) Seek(offset int64, whence int) (int64, error) {
+	totalFrames := int64(r.decoder.Duration().Seconds() * sampleRate)
+	frame, err := resolveSeek(offset, whence, r.pcm.pos, outputFrameSize, totalFrames)
+	if err != nil {
+		return 0, err
+	}
+	srcFrame := float64(frame) * r.step
+	whole := int64(srcFrame)
+	if _, err := r.decoder.Seek(whole*int64(len(r.srcFrame)), io.SeekStart); err != nil {
+		return 0, err
+	}
+	r.src.Reset(r.decoder)
+	r.started = false
+	r.pos = srcFrame - float64(whole)
+	r.pcm.seekTo(frame * outputFrameSize)
+	return r.pcm.pos, nil
+}
+
+func (r *resampler) fill() error {
+	if !r.started {
+		if err := r.readFrame(&r.prev); err != nil {
+			return err
+		}
+		if err := r.readFrame(&r.next); err != nil {
+			return err
+		}
+		r.started = true
+	}
+	for i := 0; i < resampleChunkFrames; i++ {
+		for r.pos >= 1 {
+			r.prev = r.next
+			if err := r.readFrame(&r.next); err != nil {
+				if i > 0 && errors.Is(err, io.EOF) {
+					// hand out what we have, the next fill reports the end.
+					return nil
+				}
+				return err
+			}
+			r.pos--
+		}
+		for ch := range r.prev {
+			r.pcm.appendSample(int16(r.prev[ch] + (r.next[ch]-r.prev[ch])*r.pos))
+		}
+		r.pos += r.step
+	}
+	return nil
+}
@@ -5,56 +5,87 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"strings"
 )
 
-type noopCloser struct {
-	io.Reader
-}
-
-func (*noopCloser) Close() error { return nil }
-
+// Skin is a Winamp skin, either a .wsz/.zip archive or a directory it was extracted to. Files are looked up by
+// name ignoring case and wherever they are inside it, as Winamp does with skins zipped along with their folder.
 type Skin struct {
-	files map[string][]byte
+	// names are the paths of the files by lowercase file name, open opens them by path.
+	names map[string]string
+	open  func(path string) (io.ReadCloser, error)
 }
 
 func (s *Skin) Open(name string) (io.ReadCloser, error) {
-	f, ok := s.files[name]
+	p, ok := s.names[strings.ToLower(name)]
 	if !ok {
 		return nil, os.ErrNotExist
 	}
-	return &noopCloser{bytes.NewReader(f)}, nil
+	return s.open(p)
 }
 
-// we can afford to load this into memory, they are tiny
-func skinFromPath(skinPath string) (*Skin, error) {
-	f, err := os.Open(skinPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open skin file: %w", err)
+// add indexes the file at p, files closer to the top win over ones with the same name deeper down. Some archives
+// made on Windows separate directories with backslashes.
+func (s *Skin) add(p string) {
+	name := strings.ToLower(p[strings.LastIndexAny(p, `/\`)+1:])
+	depth := func(p string) int {
+		return strings.Count(p, "/") + strings.Count(p, `\`)
 	}
-	defer f.Close()
-	fInfo, err := f.Stat()
+	if existing, ok := s.names[name]; !ok || depth(p) < depth(existing) {
+		s.names[name] = p
+	}
+}
+
+// skinFromPath opens the skin at skinPath, archives are read into memory as they are tiny while directories are
+// read from disk every time so changes to their files show up.
+func skinFromPath(skinPath string) (*Skin, error) {
+	fInfo, err := os.Stat(skinPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat skin file: %w", err)
 	}
-	zf, err := zip.NewReader(f, fInfo.Size())
+	s := &Skin{
+		names: make(map[string]string),
+	}
+	if fInfo.IsDir() {
+		fsys := os.DirFS(skinPath)
+		err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				s.add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read skin directory: %w", err)
+		}
+		s.open = func(p string) (io.ReadCloser, error) {
+			return fsys.Open(p)
+		}
+		return s, nil
+	}
+
+	data, err := os.ReadFile(skinPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open skin file: %w", err)
 	}
-	s := &Skin{
-		files: make(map[string][]byte),
+	zf, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open skin file: %w", err)
 	}
+	files := make(map[string]*zip.File)
 	for _, file := range zf.File {
-		r, err := file.Open()
-		if err != nil {
-			return nil, fmt.Errorf("failed to open skin file: %w", err)
+		if file.FileInfo().IsDir() {
+			continue
 		}
-		s.files[strings.ToLower(file.Name)], err = io.ReadAll(r)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read skin file: %w", err)
-		}
-		r.Close() // this is likely not that important as f closes upon exit.
+		files[file.Name] = file
+		s.add(file.Name)
+	}
+	s.open = func(p string) (io.ReadCloser, error) {
+		return files[p].Open()
 	}
 	return s, nil
 }
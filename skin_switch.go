@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// reskinner loads what a part of the UI needs from a new skin without changing what is shown, the returned func
+// shows it. Nothing is shown unless every part could load the skin.
+type reskinner func(skin *Skin) (apply func(), err error)
+
+// skinSwitcher changes the skin of every window while running, sprites keep their state so neither playback nor
+// toggles nor the windows are touched.
+type skinSwitcher struct {
+	mu    sync.Mutex
+	path  string
+	parts []reskinner
+}
+
+// add makes part follow the skin.
+func (s *skinSwitcher) add(part reskinner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parts = append(s.parts, part)
+}
+
+// Path is where the skin in use was loaded from.
+func (s *skinSwitcher) Path() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.path
+}
+
+// Switch loads the skin at path into every window.
+func (s *skinSwitcher) Switch(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	skin, err := skinFromPath(path)
+	if err != nil {
+		return err
+	}
+	applies := make([]func(), 0, len(s.parts))
+	for _, part := range s.parts {
+		apply, err := part(skin)
+		if err != nil {
+			return fmt.Errorf("loading skin %s: %w", filepath.Base(path), err)
+		}
+		applies = append(applies, apply)
+	}
+	for _, apply := range applies {
+		apply()
+	}
+	s.path = path
+	return nil
+}
+
+// skinsInDir lists the skins in dir, .wsz and .zip archives as well as the directories they were extracted to.
+func skinsInDir(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing skins: %w", err)
+	}
+	var skins []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || ext == ".wsz" || ext == ".zip" {
+			skins = append(skins, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Slice(skins, func(i, j int) bool {
+		return strings.ToLower(skins[i]) < strings.ToLower(skins[j])
+	})
+	return skins, nil
+}
+
+// skinBrowser is the window listing the skins of the skins directory, picking one switches to it.
+type skinBrowser struct {
+	w        fyne.Window
+	dir      string
+	switcher *skinSwitcher
+	list     *widget.List
+	skins    []string
+}
+
+func newSkinBrowser(a fyne.App, dir string, switcher *skinSwitcher) *skinBrowser {
+	b := &skinBrowser{
+		w:        a.NewWindow("Skin Browser"),
+		dir:      dir,
+		switcher: switcher,
+	}
+	b.list = widget.NewList(
+		func() int {
+			return len(b.skins)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(i widget.ListItemID, item fyne.CanvasObject) {
+			name := filepath.Base(b.skins[i])
+			item.(*widget.Label).SetText(strings.TrimSuffix(name, filepath.Ext(name)))
+		})
+	b.list.OnSelected = func(i widget.ListItemID) {
+		if i >= len(b.skins) || b.skins[i] == switcher.Path() {
+			return
+		}
+		if err := switcher.Switch(b.skins[i]); err != nil {
+			dialog.ShowError(err, b.w)
+		}
+	}
+	b.w.SetContent(b.list)
+	b.w.Resize(fyne.NewSize(300, 400))
+	// closing only hides it, it is shown again with the skins listed anew.
+	b.w.SetCloseIntercept(b.w.Hide)
+	return b
+}
+
+// show lists the skins again and opens the browser with the one in use selected.
+func (b *skinBrowser) show() {
+	skins, err := skinsInDir(b.dir)
+	if err != nil {
+		dialog.ShowError(err, b.w)
+	}
+	b.skins = skins
+	b.list.UnselectAll()
+	b.list.Refresh()
+	for i, skin := range skins {
+		if skin == b.switcher.Path() {
+			b.list.Select(i)
+		}
+	}
+	b.w.Show()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"math"
 
 	"fyne.io/fyne/v2"
 )
@@ -14,7 +15,9 @@ type SpriteStack struct {
 	fileCache     map[string]image.Image
 	skin          *Skin
 	actionHandler map[string]func() error
-	draggedItem   int
+	// dragHandler are called while sprites with the matching action are dragged.
+	dragHandler map[string]func() error
+	draggedItem int
 }
 
 func (s *SpriteStack) FindByID(name string) *AnimatedSprite {
@@ -41,22 +44,41 @@ func (s *SpriteStack) Dragged(event *fyne.DragEvent) {
 			return
 		}
 	}
-	fmt.Println(s.sprites[s.draggedItem].ID)
-	if s.sprites[s.draggedItem].DragAble &&
-		x > s.sprites[s.draggedItem].MinDragX &&
-		x < s.sprites[s.draggedItem].MaxDragX {
-		s.sprites[s.draggedItem].AbsolutePositionX = x
+	sp := s.sprites[s.draggedItem]
+	fmt.Println(sp.ID)
+	if !sp.DragAble {
 		return
 	}
+	// the sprite follows the pointer along its axis, up to the ends of its range.
+	if sp.Vertical {
+		sp.AbsolutePositionY = min(max(y, sp.MinDragX), sp.MaxDragX)
+	} else {
+		sp.AbsolutePositionX = min(max(x, sp.MinDragX), sp.MaxDragX)
+	}
+	s.callDrag(sp)
 }
 
 func (s *SpriteStack) DragEnd() {
-	if s.draggedItem < 0 {
-		s.sprites[s.draggedItem].dePressed()
+	if s.draggedItem >= 0 {
+		sp := s.sprites[s.draggedItem]
+		if sp.DragAble {
+			// dragable sprites act once the drag is done, where they were left.
+			sp.dePressed()
+			s.callAction(sp)
+		} else {
+			// buttons pressed and moved a bit are released by MouseUp, which also toggles them, here they only stop
+			// looking pressed in case the pointer left them.
+			sp.Pressed = false
+		}
 	}
 	s.draggedItem = -1
 }
 
+// IsDragging reports whether the given sprite is being dragged right now.
+func (s *SpriteStack) IsDragging(sp *AnimatedSprite) bool {
+	return s.draggedItem >= 0 && s.sprites[s.draggedItem] == sp
+}
+
 func (s *SpriteStack) DrawAtPosition(x, y int) color.Color {
 	for i := range s.sprites {
 		s := s.sprites[len(s.sprites)-i-1]
@@ -82,21 +104,72 @@ func (s *SpriteStack) DoAtPosition(x, y int) {
 		sp := s.sprites[len(s.sprites)-i-1]
 		if sp.Collision(x, y) {
 			sp.dePressed()
-			if sp.Action != "" && s.actionHandler != nil {
-				if fn, ok := s.actionHandler[sp.Action]; ok {
-					err := fn()
-					if err != nil {
-						// FIXME: Bubble this up
-						fmt.Println(fmt.Errorf("error calling action %s: %v", sp.Action, err))
-					}
-				}
-				return
+			// dragable sprites get their action called on DragEnd
+			if !sp.DragAble {
+				s.callAction(sp)
 			}
 			return
 		}
 	}
 }
 
+// releasePressed makes every sprite look released, once the mouse button is.
+func (s *SpriteStack) releasePressed() {
+	for _, sp := range s.sprites {
+		sp.Pressed = false
+	}
+}
+
+func (s *SpriteStack) callAction(sp *AnimatedSprite) {
+	if sp.Action != "" && s.actionHandler != nil {
+		if fn, ok := s.actionHandler[sp.Action]; ok {
+			err := fn()
+			if err != nil {
+				// FIXME: Bubble this up
+				fmt.Println(fmt.Errorf("error calling action %s: %v", sp.Action, err))
+			}
+		}
+	}
+}
+
+func (s *SpriteStack) callDrag(sp *AnimatedSprite) {
+	if fn, ok := s.dragHandler[sp.Action]; ok && sp.Action != "" {
+		if err := fn(); err != nil {
+			fmt.Println(fmt.Errorf("error dragging %s: %v", sp.Action, err))
+		}
+	}
+}
+
+// loadImages decodes every file the sprites use from skin, leaving the ones shown alone so nothing changes if one of
+// them is missing.
+func (s *SpriteStack) loadImages(skin *Skin) (map[string]image.Image, error) {
+	fileCache := map[string]image.Image{}
+	for _, sp := range s.sprites {
+		for _, img := range sp.images() {
+			if _, ok := fileCache[img.File]; ok {
+				continue
+			}
+			rawImg, err := loadSkinImage(skin, img.File)
+			if err != nil {
+				return nil, fmt.Errorf("loading Animated Sprite %s: %w", sp.ID, err)
+			}
+			fileCache[img.File] = rawImg
+		}
+	}
+	return fileCache, nil
+}
+
+// useImages draws the sprites from the files loadImages got from skin, their state is kept.
+func (s *SpriteStack) useImages(skin *Skin, fileCache map[string]image.Image) {
+	s.skin = skin
+	s.fileCache = fileCache
+	for _, sp := range s.sprites {
+		for _, img := range sp.images() {
+			img.Image = fileCache[img.File]
+		}
+	}
+}
+
 func (s *SpriteStack) UnmarshalJSON(data []byte) error {
 	var tgt []*AnimatedSprite
 	if err := json.Unmarshal(data, &tgt); err != nil {
@@ -126,12 +199,27 @@ type AnimatedSprite struct {
 	Tooltip           string  `json:"tooltip"`
 	ToggleAble        bool    `json:"isToggle"`
 	DragAble          bool    `json:"dragAble"`
-	MinDragX          int     `json:"minDrag"`
-	MaxDragX          int     `json:"maxDrag"`
+	// Vertical sprites are dragged up and down, MinDragX and MaxDragX are then their range of Y.
+	Vertical bool          `json:"dragVertical"`
+	MinDragX int           `json:"minDrag"`
+	MaxDragX int           `json:"maxDrag"`
+	Frames   *SpriteFrames `json:"frames"`
 
 	// These are not part of the json, they are used to track the state of the sprite
 	Pressed bool `json:"-"`
 	Toggled bool `json:"-"`
+	// Frame is the one of Frames being shown.
+	Frame int `json:"-"`
+}
+
+// SpriteFrames describes sprites that have several looks laid out in a grid in the skin, such as slider backgrounds
+// that change with their value. The first frame is the sprite image, the rest are Columns per row, StepX and StepY
+// pixels apart. Steps can be negative, as for the lit mono and stereo which are above the unlit ones.
+type SpriteFrames struct {
+	Count   int `json:"count"`
+	Columns int `json:"columns"`
+	StepX   int `json:"stepX"`
+	StepY   int `json:"stepY"`
 }
 
 func (s *AnimatedSprite) Collision(x, y int) bool {
@@ -140,6 +228,18 @@ func (s *AnimatedSprite) Collision(x, y int) bool {
 	return inX && inY
 }
 
+// images returns the sprites of every look of s.
+func (s *AnimatedSprite) images() []*Sprite {
+	images := []*Sprite{&s.Image}
+	if s.DownImage != nil {
+		images = append(images, s.DownImage)
+	}
+	if s.ActiveImage != nil {
+		images = append(images, s.ActiveImage)
+	}
+	return images
+}
+
 func (s *AnimatedSprite) Load(skin *Skin, fileCache map[string]image.Image) error {
 	if err := s.Image.Load(skin, fileCache); err != nil {
 		return fmt.Errorf("loading Sprite: %s in Animated Sprite %s: %w", s.Image.ID, s.ID, err)
@@ -171,16 +271,11 @@ type Sprite struct {
 func (s *Sprite) Load(skin *Skin, fileCache map[string]image.Image) error {
 	rawImg, ok := fileCache[s.File]
 
-	// I suspect that, due to this was done for fat32, the skins contain uppercase filenames.
 	if !ok {
-		f, err := skin.Open(s.File)
-		if err != nil {
-			return fmt.Errorf("opening file: %s: %w", s.File, err)
-		}
-		defer f.Close()
-		rawImg, _, err = image.Decode(f)
+		var err error
+		rawImg, err = loadSkinImage(skin, s.File)
 		if err != nil {
-			return fmt.Errorf("decoding image: %s: %w", s.File, err)
+			return err
 		}
 		fileCache[s.File] = rawImg
 	}
@@ -188,6 +283,21 @@ func (s *Sprite) Load(skin *Skin, fileCache map[string]image.Image) error {
 	return nil
 }
 
+// loadSkinImage decodes one of the bitmaps of the skin.
+func loadSkinImage(skin *Skin, file string) (image.Image, error) {
+	// I suspect that, due to this was done for fat32, the skins contain uppercase filenames.
+	f, err := skin.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %s: %w", file, err)
+	}
+	defer f.Close()
+	rawImg, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %s: %w", file, err)
+	}
+	return rawImg, nil
+}
+
 func (s *AnimatedSprite) pressed() {
 	s.Pressed = true
 }
@@ -213,6 +323,10 @@ func (s *Sprite) At(x, y int) color.Color {
 func (s *AnimatedSprite) At(x, y int) color.Color {
 	posX := x - s.AbsolutePositionX
 	posY := y - s.AbsolutePositionY
+	if s.Frames != nil && s.Frames.Columns > 0 {
+		posX += s.Frame % s.Frames.Columns * s.Frames.StepX
+		posY += s.Frame / s.Frames.Columns * s.Frames.StepY
+	}
 	if s.Pressed && s.DownImage != nil {
 		return s.DownImage.At(posX, posY)
 	}
@@ -226,7 +340,33 @@ func (s *AnimatedSprite) DraggableSeek(percentage float64) {
 	if !s.DragAble || (percentage > 1 || percentage < 0) {
 		return
 	}
-	s.AbsolutePositionX = s.MinDragX + int(float64(s.MaxDragX-s.MinDragX)*percentage)
+	pos := s.MinDragX + int(math.Round(float64(s.MaxDragX-s.MinDragX)*percentage))
+	if s.Vertical {
+		s.AbsolutePositionY = pos
+		return
+	}
+	s.AbsolutePositionX = pos
+}
+
+// DraggablePosition is the inverse of DraggableSeek, it returns where in its range the sprite is as a value in [0, 1].
+func (s *AnimatedSprite) DraggablePosition() float64 {
+	if !s.DragAble || s.MaxDragX <= s.MinDragX {
+		return 0
+	}
+	pos := s.AbsolutePositionX
+	if s.Vertical {
+		pos = s.AbsolutePositionY
+	}
+	return float64(pos-s.MinDragX) / float64(s.MaxDragX-s.MinDragX)
+}
+
+// SetFrameAt shows the frame at the given point of the frames, as a value in [0, 1].
+func (s *AnimatedSprite) SetFrameAt(percentage float64) {
+	if s.Frames == nil || s.Frames.Count == 0 {
+		return
+	}
+	percentage = math.Max(0, math.Min(1, percentage))
+	s.Frame = int(math.Round(percentage * float64(s.Frames.Count-1)))
 }
 
 var _ image.Image = (*AnimatedSprite)(nil)
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// track is a playlist entry opened for playing, its source yields PCM in the output format.
+type track struct {
+	entry PlaylistEntry
+	// index is the position of the entry in the playlist when it was opened.
+	index int
+	// version is the one of the playlist when the track was preloaded, a different one means it may be stale.
+	version uint64
+	file    *os.File
+	decoder *meteredDecoder
+	source  io.ReadSeeker
+	length  time.Duration
+	// gain sets the volume of source as ReplayGain says.
+	gain *replayGainSource
+	// startAt is the offset in the stream where the beginning of the track lands.
+	startAt int64
+	// pos is the offset in source.
+	pos int64
+	// seq orders tracks by when they entered the stream.
+	seq uint64
+}
+
+func openTrack(index int, entry PlaylistEntry) (*track, error) {
+	f, err := os.Open(entry.Path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %q failed: %w", entry.Path, err)
+	}
+	// Decode file as it plays, only a small read ahead buffer is kept in memory.
+	// The format is picked from its contents and extension.
+	decoded, err := newDecoder(entry.Path, newReadAheadReader(f))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("decoding %q failed: %w", entry.Path, err)
+	}
+	// songs without tags are shown by their file name.
+	if entry.Info, err = readTrackInfo(entry.Path); err != nil && !errors.Is(err, errNoTags) {
+		fmt.Println(err)
+	}
+	// The context only takes stereo at sampleRate so anything else is converted on the way.
+	gain := newReplayGainSource(newResampler(decoded), entry.Info.ReplayGain)
+	if rg := entry.Info.ReplayGain; !rg.HasTrack && !rg.HasAlbum {
+		// songs without ReplayGain tags are measured, while the first time they play.
+		if rg, ok := loudness.lookup(entry.Path, gain.setValues); ok {
+			gain.setValues(rg)
+		}
+	}
+	return &track{
+		entry:   entry,
+		index:   index,
+		file:    f,
+		decoder: decoded,
+		source:  gain,
+		gain:    gain,
+		length:  decoded.Duration(),
+	}, nil
+}
+
+func (t *track) Close() error {
+	return t.file.Close()
+}
+
+// stream is the only source the oto player ever reads from, songs are spliced one after the other in it so there is
+// no gap between them, or mixed for a while when crossfading. Seeking it seeks the track being read.
+//
+// oto reads the stream with its own lock held, so nothing may call into oto while holding the lock of the stream.
+type stream struct {
+	mu      sync.Mutex
+	current *track
+	// next is spliced right after current when it ends.
+	next *track
+	// previous are tracks that were read completely but can still be in oto's buffer.
+	previous []*track
+	// read is the amount of bytes handed to oto.
+	read  int64
+	ended bool
+	// crossfade is how many bytes of two tracks overlap, 0 when they are spliced.
+	crossfade int64
+	curve     CrossfadeCurve
+	// fadeOut is the track being mixed out of the stream while current fades in, fadePos bytes of fadeLen are done.
+	fadeOut          *track
+	fadePos, fadeLen int64
+	fadeBuf          []byte
+	// seq is the one of the last track that entered the stream.
+	seq uint64
+	// replayGain is the mode of the tracks in the stream.
+	replayGain ReplayGainMode
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for s.current != nil && total < len(p) {
+		buf := p[total:]
+		switch until := s.untilFade(); {
+		case until == 0 && s.currentSize() > s.current.pos:
+			// the rest of the current track is mixed with the beginning of the next one.
+			if err := s.startFade(s.currentSize() - s.current.pos); err != nil {
+				return total, err
+			}
+		case until > 0 && until < int64(len(buf)):
+			buf = buf[:until]
+		}
+		n, err := s.current.source.Read(buf)
+		s.current.pos += int64(n)
+		if s.fadeOut != nil {
+			if mErr := s.mix(buf[:n]); mErr != nil {
+				return total, mErr
+			}
+		}
+		total += n
+		s.read += int64(n)
+		if err == io.EOF {
+			if fErr := s.stopFade(); fErr != nil {
+				return total, fErr
+			}
+			if s.next == nil {
+				s.ended = true
+				break
+			}
+			s.previous = append(s.previous, s.current)
+			s.current = s.next
+			s.current.startAt = s.read
+			s.next = nil
+			continue
+		}
+		if err != nil {
+			return total, err
+		}
+		// a short read is fine unless it was the end of a track
+		break
+	}
+	if total == 0 && (s.current == nil || s.ended) {
+		return 0, io.EOF
+	}
+	return total, nil
+}
+
+// Seek moves in the current track, offsets are relative to its beginning. oto drops its buffer when seeking so
+// anything read before can't be heard anymore.
+func (s *stream) Seek(offset int64, whence int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return 0, nil
+	}
+	if whence == io.SeekCurrent {
+		whence = io.SeekStart
+		offset += s.read - s.current.startAt
+	}
+	pos, err := s.current.source.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	// the seek itself went fine, closing what was before it can only be reported.
+	err = s.closePrevious()
+	if fErr := s.stopFade(); err == nil {
+		err = fErr
+	}
+	if err != nil {
+		fmt.Println(fmt.Errorf("closing previous songs: %w", err))
+	}
+	s.current.pos = pos
+	s.current.startAt = s.read - pos
+	s.ended = false
+	return pos, nil
+}
+
+// replace makes t the current track, it is read from its beginning after the next Seek, every other track is closed.
+func (s *stream) replace(t *track) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.closePrevious()
+	if fErr := s.stopFade(); err == nil {
+		err = fErr
+	}
+	if s.current != nil {
+		if cErr := s.current.Close(); err == nil {
+			err = cErr
+		}
+	}
+	if dErr := s.dropNextLocked(); err == nil {
+		err = dErr
+	}
+	s.current = t
+	if t != nil {
+		s.enter(t)
+		t.startAt = s.read
+	}
+	s.ended = false
+	return err
+}
+
+// setNext queues the track to be spliced after the current one.
+func (s *stream) setNext(t *track) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.dropNextLocked()
+	s.enter(t)
+	s.next = t
+	// the stream may have run dry while t was being opened.
+	s.ended = false
+	return err
+}
+
+// enter numbers a track entering the stream and sets its ReplayGain mode.
+func (s *stream) enter(t *track) {
+	s.seq++
+	t.seq = s.seq
+	t.gain.setMode(s.replayGain)
+}
+
+func (s *stream) dropNext() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropNextLocked()
+}
+
+func (s *stream) dropNextLocked() error {
+	if s.next == nil {
+		return nil
+	}
+	err := s.next.Close()
+	s.next = nil
+	return err
+}
+
+func (s *stream) closePrevious() error {
+	var err error
+	for _, t := range s.previous {
+		if cErr := t.Close(); err == nil {
+			err = cErr
+		}
+	}
+	s.previous = nil
+	return err
+}
+
+// streamState is a snapshot of the stream for the player loop.
+type streamState struct {
+	current, next *track
+	// heard is the track being heard given how much of the stream is still buffered in oto.
+	heard *track
+	// position is the one of what is being heard in heard.
+	position int64
+	ended    bool
+}
+
+func (s *stream) state(buffered int) streamState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heardAt := s.read - int64(buffered)
+	st := streamState{current: s.current, next: s.next, ended: s.ended}
+	// a track fading out is heard until the one fading in starts being heard. previous has room to grow that Read
+	// appends to, so it isn't appended to here.
+	tracks := make([]*track, 0, len(s.previous)+2)
+	tracks = append(append(tracks, s.previous...), s.fadeOut, s.current)
+	for _, t := range tracks {
+		if t != nil && t.startAt <= heardAt {
+			st.heard = t
+		}
+	}
+	if st.heard == nil {
+		st.heard = s.current
+	}
+	if st.heard != nil {
+		st.position = heardAt - st.heard.startAt
+		if st.position < 0 {
+			st.position = 0
+		}
+	}
+	return st
+}
+
+// release closes the tracks that were heard before t, they won't be needed anymore.
+func (s *stream) release(t *track) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for i, prev := range s.previous {
+		if prev != t {
+			continue
+		}
+		for _, done := range s.previous[:i] {
+			if cErr := done.Close(); err == nil {
+				err = cErr
+			}
+		}
+		s.previous = s.previous[i:]
+		return err
+	}
+	if t == s.current {
+		return s.closePrevious()
+	}
+	return nil
+}
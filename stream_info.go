@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// StreamInfo is what the main window shows of the encoded stream of a song.
+type StreamInfo struct {
+	// Bitrate is in kbps, for VBR streams it is the one of the last second decoded. 0 if unknown.
+	Bitrate    int
+	SampleRate int
+	// Channels is how many the file has, decoders may yield more, as go-mp3 does with mono.
+	Channels int
+}
+
+// countingReader counts the bytes decoders read from the file.
+type countingReader struct {
+	io.ReadSeeker
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadSeeker.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// meteredDecoder measures the bitrate of its Decoder by how much of the file it reads for how much PCM it yields,
+// which works for any format. Until a second of PCM was yielded the bitrate is the average of the whole file.
+type meteredDecoder struct {
+	Decoder
+	in       *countingReader
+	channels int
+	// read and frames are what was read from the file and yielded since the second being measured started.
+	read, frames int64
+	mu           sync.Mutex
+	bitrate      int
+}
+
+// newMeteredDecoder wraps the Decoder that reads in, size is the one of the file.
+func newMeteredDecoder(d Decoder, in *countingReader, channels int, size int64) *meteredDecoder {
+	m := &meteredDecoder{Decoder: d, in: in, channels: channels}
+	if seconds := d.Duration().Seconds(); seconds > 0 {
+		m.bitrate = int(float64(size) * 8 / seconds / 1000)
+	}
+	return m
+}
+
+func (m *meteredDecoder) Read(p []byte) (int, error) {
+	before := m.in.n
+	n, err := m.Decoder.Read(p)
+	m.read += m.in.n - before
+	m.frames += int64(n / (m.ChannelCount() * bytesPerSample))
+	if rate := m.SampleRate(); rate > 0 && m.frames >= int64(rate) {
+		m.mu.Lock()
+		m.bitrate = int(m.read * 8 * int64(rate) / m.frames / 1000)
+		m.mu.Unlock()
+		m.read, m.frames = 0, 0
+	}
+	return n, err
+}
+
+// Seek starts measuring anew, decoders read around to find where to land.
+func (m *meteredDecoder) Seek(offset int64, whence int) (int64, error) {
+	pos, err := m.Decoder.Seek(offset, whence)
+	m.read, m.frames = 0, 0
+	return pos, err
+}
+
+// StreamInfo can be called while the decoder is being read.
+func (m *meteredDecoder) StreamInfo() StreamInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return StreamInfo{
+		Bitrate:    m.bitrate,
+		SampleRate: m.SampleRate(),
+		Channels:   m.channels,
+	}
+}
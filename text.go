@@ -104,6 +104,8 @@ type TextSprite struct {
 	Image             image.Image
 	AbsolutePositionX int
 	AbsolutePositionY int
+	// NoEllipsis leaves the last character alone, for texts that always fit.
+	NoEllipsis bool
 }
 
 func (t *TextSprite) Set(text string) {
@@ -184,7 +186,7 @@ func (t *TextSprite) DrawAtPosition(x, y int) color.Color {
 				spriteString[i] = p
 			}
 		}
-		if !t.Numeric {
+		if !t.Numeric && !t.NoEllipsis {
 			spriteString[t.StrLen-1] = useMap[ellipse]
 		}
 		t.RenderedText = spriteString
@@ -213,7 +215,7 @@ type TextLayer struct {
 }
 
 func (t *TextSprite) Collision(x, y int) bool {
-	inX := x >= t.AbsolutePositionX && x < (t.AbsolutePositionX+t.RuneWidth()+t.CharSpacing)*t.StrLen
+	inX := x >= t.AbsolutePositionX && x < t.AbsolutePositionX+(t.RuneWidth()+t.CharSpacing)*t.StrLen
 	inY := y >= t.AbsolutePositionY && y < t.AbsolutePositionY+t.RuneHeight()
 	return inX && inY
 }
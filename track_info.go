@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrackInfo is what the tags of a song say about it, whether they are ID3, Vorbis comments or APE. Fields the tags
+// don't have are left empty.
+type TrackInfo struct {
+	Artist  string
+	Title   string
+	Album   string
+	Year    string
+	Genre   string
+	Comment string
+	// Track and Disc are the number of the song in its album and of the disc in the set, 0 if unknown.
+	Track      int
+	Disc       int
+	ReplayGain ReplayGain
+	// Pictures are the images embedded in the tags, like the album cover.
+	Pictures []Picture
+}
+
+// ReplayGain is how much to change the volume of a song, in dB, so it sounds as loud as any other, alone or as part
+// of its album. Peaks are the loudest sample as a fraction of full scale, 0 if unknown.
+type ReplayGain struct {
+	TrackGain, TrackPeak float64
+	AlbumGain, AlbumPeak float64
+	HasTrack, HasAlbum   bool
+}
+
+// Picture is an image embedded in the tags, Type is the one of ID3 APIC frames, also used by FLAC.
+type Picture struct {
+	Type        int
+	MIMEType    string
+	Description string
+	Data        []byte
+}
+
+// pictureFrontCover is the Type of album covers.
+const pictureFrontCover = 3
+
+// empty tells if no tag said anything.
+func (info *TrackInfo) empty() bool {
+	return info.Artist == "" && info.Title == "" && info.Album == "" && info.Year == "" && info.Genre == "" &&
+		info.Comment == "" && info.Track == 0 && info.Disc == 0 && !info.ReplayGain.HasTrack &&
+		!info.ReplayGain.HasAlbum && len(info.Pictures) == 0
+}
+
+// merge fills the fields info doesn't have with the ones of other.
+func (info *TrackInfo) merge(other TrackInfo) {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&info.Artist, other.Artist)
+	fill(&info.Title, other.Title)
+	fill(&info.Album, other.Album)
+	fill(&info.Year, other.Year)
+	fill(&info.Genre, other.Genre)
+	fill(&info.Comment, other.Comment)
+	if info.Track == 0 {
+		info.Track = other.Track
+	}
+	if info.Disc == 0 {
+		info.Disc = other.Disc
+	}
+	if !info.ReplayGain.HasTrack && other.ReplayGain.HasTrack {
+		info.ReplayGain.TrackGain, info.ReplayGain.TrackPeak = other.ReplayGain.TrackGain, other.ReplayGain.TrackPeak
+		info.ReplayGain.HasTrack = true
+	}
+	if !info.ReplayGain.HasAlbum && other.ReplayGain.HasAlbum {
+		info.ReplayGain.AlbumGain, info.ReplayGain.AlbumPeak = other.ReplayGain.AlbumGain, other.ReplayGain.AlbumPeak
+		info.ReplayGain.HasAlbum = true
+	}
+	if len(info.Pictures) == 0 {
+		info.Pictures = other.Pictures
+	}
+}
+
+// setField sets the field named key, by the names Vorbis comments and APE tags use, which ID3 also does for
+// ReplayGain. Unknown keys and values that don't parse are ignored.
+func (info *TrackInfo) setField(key, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	switch strings.ToLower(key) {
+	case "title":
+		info.Title = value
+	case "artist":
+		info.Artist = value
+	case "album":
+		info.Album = value
+	case "date", "year":
+		// dates can be full timestamps, we only show the year.
+		info.Year = value[:min(4, len(value))]
+	case "genre":
+		info.Genre = value
+	case "comment", "description":
+		info.Comment = value
+	case "tracknumber", "track":
+		info.Track = leadingNumber(value)
+	case "discnumber", "disc":
+		info.Disc = leadingNumber(value)
+	case "replaygain_track_gain":
+		if gain, ok := parseGain(value); ok {
+			info.ReplayGain.TrackGain, info.ReplayGain.HasTrack = gain, true
+		}
+	case "replaygain_track_peak":
+		info.ReplayGain.TrackPeak, _ = strconv.ParseFloat(value, 64)
+	case "replaygain_album_gain":
+		if gain, ok := parseGain(value); ok {
+			info.ReplayGain.AlbumGain, info.ReplayGain.HasAlbum = gain, true
+		}
+	case "replaygain_album_peak":
+		info.ReplayGain.AlbumPeak, _ = strconv.ParseFloat(value, 64)
+	}
+}
+
+// leadingNumber parses numbers that can come with a total, as in 3/12.
+func leadingNumber(value string) int {
+	number, _, _ := strings.Cut(value, "/")
+	n, _ := strconv.Atoi(strings.TrimSpace(number))
+	return n
+}
+
+// parseGain parses gains as taggers write them: "-6.54 dB".
+func parseGain(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[len(value)-2:], "db") {
+		value = strings.TrimSpace(value[:len(value)-2])
+	}
+	gain, err := strconv.ParseFloat(value, 64)
+	return gain, err == nil
+}
+
+// errNoTags is returned for files without any tag we understand.
+var errNoTags = errors.New("no tags")
+
+// tagReaders read each kind of tag, the ones first take precedence when tags disagree.
+var tagReaders = []func(r io.ReadSeeker) (TrackInfo, error){
+	readID3v2,
+	readVorbisComments,
+	readAPEv2,
+	readID3v1,
+}
+
+// readTrackInfo reads every tag of the song at path and merges them.
+func readTrackInfo(path string) (TrackInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return TrackInfo{}, fmt.Errorf("opening %q failed: %w", path, err)
+	}
+	defer f.Close()
+	var info TrackInfo
+	var found bool
+	var firstErr error
+	for _, read := range tagReaders {
+		tags, err := read(f)
+		if err != nil {
+			if !errors.Is(err, errNoTags) && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		info.merge(tags)
+		found = true
+	}
+	if found {
+		return info, nil
+	}
+	if firstErr != nil {
+		return TrackInfo{}, fmt.Errorf("reading tags of %q: %w", path, firstErr)
+	}
+	return TrackInfo{}, errNoTags
+}
+
+// titleFormat is how Winamp shows songs: their position in the playlist, artist, title and length.
+const titleFormat = "%n. %a - %t (%l)"
+
+// formatTitle fills format with what is known of entry at position in the playlist:
+//
+//	%n	position in the playlist, from 1
+//	%a	artist
+//	%t	title
+//	%b	album
+//	%y	year
+//	%g	genre
+//	%l	length, as m:ss
+//	%f	file name
+//	%%	a %
+//
+// Songs without a title in their tags show what DisplayTitle does in place of "%a - %t", and the length is left out
+// with its parenthesis when it is unknown.
+func formatTitle(format string, position int, entry PlaylistEntry) string {
+	info := entry.Info
+	if info.Title == "" {
+		info = TrackInfo{Title: entry.DisplayTitle()}
+	}
+	if info.Artist == "" {
+		format = strings.ReplaceAll(format, "%a - ", "")
+	}
+	if entry.Length <= 0 {
+		format = strings.ReplaceAll(format, " (%l)", "")
+	}
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'n':
+			b.WriteString(strconv.Itoa(position + 1))
+		case 'a':
+			b.WriteString(info.Artist)
+		case 't':
+			b.WriteString(info.Title)
+		case 'b':
+			b.WriteString(info.Album)
+		case 'y':
+			b.WriteString(info.Year)
+		case 'g':
+			b.WriteString(info.Genre)
+		case 'l':
+			b.WriteString(formatLength(entry.Length))
+		case 'f':
+			b.WriteString(filepath.Base(entry.Path))
+		default:
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+// formatLength writes d as m:ss, the way lengths are shown next to songs.
+func formatLength(d time.Duration) string {
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// visTapSize is how many frames visTap remembers, it has to reach back past what oto has buffered and not played.
+const visTapSize = 1 << 15
+
+// visTap sits right before oto and keeps the last frames it read, downmixed to mono, for the visualization.
+type visTap struct {
+	src io.ReadSeeker
+	mu  sync.Mutex
+	// ring holds samples between -1 and 1, written is how many frames went through ever.
+	ring    [visTapSize]float32
+	written int64
+}
+
+func newVisTap(src io.ReadSeeker) *visTap {
+	return &visTap{src: src}
+}
+
+func (t *visTap) Read(p []byte) (int, error) {
+	n, err := t.src.Read(p)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for off := 0; off+outputFrameSize <= n; off += outputFrameSize {
+		var sum float32
+		for ch := 0; ch < outputChannels; ch++ {
+			sum += float32(int16(binary.LittleEndian.Uint16(p[off+ch*bytesPerSample:])))
+		}
+		t.ring[t.written%visTapSize] = sum / (outputChannels * 32768)
+		t.written++
+	}
+	return n, err
+}
+
+func (t *visTap) Seek(offset int64, whence int) (int64, error) {
+	return t.src.Seek(offset, whence)
+}
+
+// samples fills dst with the frames that end behind frames before the last one read, which is where the speakers
+// are when oto has that many frames buffered. What was never read or is too old is silence.
+func (t *visTap) samples(dst []float32, behind int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	start := t.written - behind - int64(len(dst))
+	for i := range dst {
+		at := start + int64(i)
+		if at < 0 || at >= t.written || at < t.written-visTapSize {
+			dst[i] = 0
+			continue
+		}
+		dst[i] = t.ring[at%visTapSize]
+	}
+}
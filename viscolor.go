@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// visColorCount is how many colors viscolor.txt has.
+const visColorCount = 24
+
+// VisPalette are the colors of the visualization in the order viscolor.txt lists them: the background, its dots, 16
+// for the spectrum from top to bottom, 5 for the oscilloscope from the brightest and the one of the peaks.
+type VisPalette [visColorCount]color.RGBA
+
+func (p *VisPalette) Background() color.RGBA { return p[0] }
+func (p *VisPalette) Dots() color.RGBA       { return p[1] }
+func (p *VisPalette) Peak() color.RGBA       { return p[23] }
+
+// Spectrum returns the color of a row of the spectrum, 0 being the top one.
+func (p *VisPalette) Spectrum(row int) color.RGBA {
+	return p[2+max(0, min(15, row))]
+}
+
+// Oscilloscope returns one of the 5 colors of the oscilloscope, 0 being the brightest.
+func (p *VisPalette) Oscilloscope(i int) color.RGBA {
+	return p[18+max(0, min(4, i))]
+}
+
+// defaultVisPalette is the one of the Winamp base skin.
+var defaultVisPalette = VisPalette{
+	{0, 0, 0, 255},
+	{24, 33, 41, 255},
+	{239, 49, 16, 255},
+	{206, 41, 16, 255},
+	{214, 90, 0, 255},
+	{214, 102, 0, 255},
+	{214, 115, 0, 255},
+	{198, 123, 8, 255},
+	{222, 165, 24, 255},
+	{214, 181, 33, 255},
+	{189, 222, 41, 255},
+	{148, 222, 33, 255},
+	{41, 206, 16, 255},
+	{50, 190, 16, 255},
+	{57, 181, 16, 255},
+	{49, 156, 8, 255},
+	{41, 148, 0, 255},
+	{24, 132, 8, 255},
+	{255, 255, 255, 255},
+	{214, 214, 222, 255},
+	{181, 189, 189, 255},
+	{160, 170, 175, 255},
+	{148, 156, 165, 255},
+	{150, 150, 150, 255},
+}
+
+var errNoVisColors = errors.New("no colors in viscolor.txt")
+
+// VisPalette returns the palette in the viscolor.txt of the skin, the default one if it has none or it can't be
+// made sense of.
+func (s *Skin) VisPalette() VisPalette {
+	f, err := s.Open("viscolor.txt")
+	if err != nil {
+		return defaultVisPalette
+	}
+	defer f.Close()
+	palette, err := parseVisPalette(f)
+	if err != nil {
+		return defaultVisPalette
+	}
+	return palette
+}
+
+// parseVisPalette reads viscolor.txt, a color per line as in "24,33,41, // grid dots". Skins in the wild separate
+// the values with spaces or tabs, go over 255 and have lines of junk in between, so the first three numbers before
+// a comment are taken and lines without them skipped. Colors missing at the end are the default ones.
+func parseVisPalette(r io.Reader) (VisPalette, error) {
+	palette := defaultVisPalette
+	found := 0
+	scanner := bufio.NewScanner(r)
+	for found < visColorCount && scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "//")
+		values := strings.FieldsFunc(line, func(r rune) bool {
+			return r < '0' || r > '9'
+		})
+		if len(values) < 3 {
+			continue
+		}
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.Atoi(values[i])
+			if err != nil {
+				// too long to be a number we care about.
+				v = 255
+			}
+			rgb[i] = uint8(min(v, 255))
+		}
+		palette[found] = color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}
+		found++
+	}
+	if err := scanner.Err(); err != nil {
+		return defaultVisPalette, err
+	}
+	if found == 0 {
+		return defaultVisPalette, errNoVisColors
+	}
+	return palette, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+)
+
+// VisMode is what the visualization of the main window shows, clicking it cycles through them like in Winamp.
+type VisMode int
+
+const (
+	VisSpectrum VisMode = iota
+	VisOscilloscope
+	VisOff
+)
+
+func (m VisMode) Cycle() VisMode {
+	return (m + 1) % 3
+}
+
+// visWidth and visHeight are the size of the visualization area of the main window.
+const visWidth = 76
+const visHeight = 16
+
+// the spectrum is drawn as bars visBarWidth wide with a column between them.
+const visBars = 19
+const visBarWidth = 3
+
+// visFFTSize is how many samples each frame of the spectrum looks at.
+const visFFTSize = 512
+
+// visInterval is how often the visualization is drawn.
+const visInterval = 30 * time.Millisecond
+
+// bars drop visBarFalloff rows each frame and peaks visPeakFalloff, they both jump up right away.
+const visBarFalloff = 1.0
+const visPeakFalloff = 0.25
+
+// visFloor is the level, in dB from full scale, at which bars are empty.
+const visFloor = 60
+
+// visualizer draws the spectrum analyzer or the oscilloscope of the main window.
+type visualizer struct {
+	x, y    int
+	palette VisPalette
+	mu      sync.Mutex
+	mode    VisMode
+	// bars and peaks are heights in rows.
+	bars  [visBars]float64
+	peaks [visBars]float64
+	// scope is the row of the wave in each column, playing tells if there is one.
+	scope   [visWidth]int
+	playing bool
+	fft     [visFFTSize]complex128
+}
+
+func newVisualizer(x, y int, palette VisPalette) *visualizer {
+	return &visualizer{x: x, y: y, palette: palette}
+}
+
+// contains tells if the point is in the visualization area.
+func (v *visualizer) contains(x, y int) bool {
+	return x >= v.x && x < v.x+visWidth && y >= v.y && y < v.y+visHeight
+}
+
+func (v *visualizer) SetPalette(palette VisPalette) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.palette = palette
+}
+
+func (v *visualizer) Mode() VisMode {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.mode
+}
+
+func (v *visualizer) SetMode(mode VisMode) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.mode = mode
+	v.bars = [visBars]float64{}
+	v.peaks = [visBars]float64{}
+}
+
+// update moves the visualization to samples, the last visFFTSize ones being heard, playing is false when there are
+// none. It reports whether it has to be drawn again.
+func (v *visualizer) update(samples []float32, playing bool) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	wasPlaying := v.playing
+	v.playing = playing
+	switch v.mode {
+	case VisSpectrum:
+		var levels [visBars]float64
+		if playing {
+			levels = v.spectrum(samples)
+		}
+		moving := false
+		for i, level := range levels {
+			v.bars[i] = max(level, v.bars[i]-visBarFalloff, 0)
+			v.peaks[i] = max(v.bars[i], v.peaks[i]-visPeakFalloff, 0)
+			moving = moving || v.peaks[i] > 0
+		}
+		return moving || playing
+	case VisOscilloscope:
+		if playing {
+			// the wave is spread over the width, each column shows one sample.
+			step := len(samples) / visWidth
+			for col := range v.scope {
+				s := max(-1, min(1, float64(samples[col*step])))
+				v.scope[col] = int(math.Round((1 - s) / 2 * (visHeight - 1)))
+			}
+		}
+		return playing || wasPlaying
+	}
+	return wasPlaying != playing
+}
+
+// spectrum returns the height of each bar for samples. Bars are spread logarithmically in frequency and show the
+// loudest bin under them.
+func (v *visualizer) spectrum(samples []float32) [visBars]float64 {
+	n := len(v.fft)
+	for i := range v.fft {
+		var s float64
+		if i < len(samples) {
+			s = float64(samples[i])
+		}
+		// a Hann window keeps the bins from bleeding into each other.
+		hann := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		v.fft[i] = complex(s*hann, 0)
+	}
+	fft(v.fft[:])
+
+	const lowest, highest = 50.0, 16000.0
+	binWidth := float64(sampleRate) / float64(n)
+	var levels [visBars]float64
+	for bar := range levels {
+		from := lowest * math.Pow(highest/lowest, float64(bar)/visBars)
+		to := lowest * math.Pow(highest/lowest, float64(bar+1)/visBars)
+		first := max(1, int(from/binWidth))
+		last := max(first, min(n/2-1, int(to/binWidth)))
+		var loudest float64
+		for bin := first; bin <= last; bin++ {
+			loudest = max(loudest, cmplx.Abs(v.fft[bin]))
+		}
+		// a full scale sine through the window peaks at n/4.
+		db := 20 * math.Log10(loudest/(float64(n)/4)+1e-9)
+		levels[bar] = max(0, min(visHeight, (db+visFloor)/visFloor*visHeight))
+	}
+	return levels
+}
+
+// fft transforms x in place, its length has to be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
+
+func (v *visualizer) DrawAtPosition(x, y int) color.Color {
+	if !v.contains(x, y) {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	col, row := x-v.x, y-v.y
+	switch v.mode {
+	case VisSpectrum:
+		if bar := col / (visBarWidth + 1); col%(visBarWidth+1) < visBarWidth {
+			fromBottom := visHeight - 1 - row
+			if v.peaks[bar] >= 1 && fromBottom == int(v.peaks[bar])-1 {
+				return v.palette.Peak()
+			}
+			if fromBottom < int(math.Round(v.bars[bar])) {
+				// the colors go from the top of the area down, tall bars get the top ones.
+				return v.palette.Spectrum(row)
+			}
+		}
+	case VisOscilloscope:
+		if v.playing {
+			// the wave is joined with the previous column so it has no holes when it is steep.
+			prev := v.scope[max(0, col-1)]
+			if min(prev, v.scope[col]) <= row && row <= max(prev, v.scope[col]) {
+				// the further from the middle, the brighter.
+				distance := math.Abs(float64(row) - (visHeight-1)/2.0)
+				return v.palette.Oscilloscope(4 - int(distance/2))
+			}
+		}
+	case VisOff:
+		return nil
+	}
+	if col%2 == 1 && row%2 == 1 {
+		return v.palette.Dots()
+	}
+	return v.palette.Background()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FLAC metadata block types.
+const (
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// Ogg streams only have their tags in the packet after the first one, a few pages in, these bound how far we look
+// in files that aren't what they seem.
+const (
+	oggMaxPages       = 64
+	oggMaxCommentSize = 1 << 24
+)
+
+// readVorbisComments reads the Vorbis comments of FLAC files and of Ogg Vorbis and Opus streams.
+func readVorbisComments(r io.ReadSeeker) (TrackInfo, error) {
+	// some FLAC files come with an ID3v2 tag in front.
+	start, err := id3v2End(r)
+	if err != nil {
+		return TrackInfo{}, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return TrackInfo{}, err
+	}
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return TrackInfo{}, errNoTags
+	}
+	switch string(magic) {
+	case "fLaC":
+		return readFLACMetadata(r)
+	case "OggS":
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return TrackInfo{}, err
+		}
+		return readOggComments(r)
+	}
+	return TrackInfo{}, errNoTags
+}
+
+// id3v2End tells where the ID3v2 tag at the start of r ends, 0 if there is none.
+func id3v2End(r io.ReadSeeker) (int64, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	header := make([]byte, id3v2HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil
+	}
+	size, _ := id3v2TagSize(header)
+	return size, nil
+}
+
+// readFLACMetadata reads the metadata blocks following the fLaC marker, each has a header telling its type, whether
+// it is the last one and its size.
+func readFLACMetadata(r io.Reader) (TrackInfo, error) {
+	var info TrackInfo
+	header := make([]byte, 4)
+	for last := false; !last; {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return TrackInfo{}, fmt.Errorf("reading FLAC metadata: %w", err)
+		}
+		last = header[0]&0x80 != 0
+		kind := header[0] & 0x7f
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if kind != flacVorbisComment && kind != flacPicture {
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return TrackInfo{}, fmt.Errorf("reading FLAC metadata: %w", err)
+			}
+			continue
+		}
+		block := make([]byte, size)
+		if _, err := io.ReadFull(r, block); err != nil {
+			return TrackInfo{}, fmt.Errorf("reading FLAC metadata: %w", err)
+		}
+		switch kind {
+		case flacVorbisComment:
+			if err := parseVorbisComments(block, &info); err != nil {
+				return TrackInfo{}, err
+			}
+		case flacPicture:
+			if picture, err := parseFLACPicture(block); err == nil {
+				info.Pictures = append(info.Pictures, picture)
+			}
+		}
+	}
+	if info.empty() {
+		return TrackInfo{}, errNoTags
+	}
+	return info, nil
+}
+
+// readOggComments puts together the packets of the first logical stream of an Ogg file until its comment packet,
+// the second one.
+func readOggComments(r io.Reader) (TrackInfo, error) {
+	var packet []byte
+	packets := 0
+	var serial uint32
+	header := make([]byte, 27)
+	for page := 0; page < oggMaxPages; page++ {
+		if _, err := io.ReadFull(r, header); err != nil || string(header[:4]) != "OggS" {
+			return TrackInfo{}, errNoTags
+		}
+		pageSerial := binary.LittleEndian.Uint32(header[14:])
+		if page == 0 {
+			serial = pageSerial
+		}
+		lacing := make([]byte, header[26])
+		if _, err := io.ReadFull(r, lacing); err != nil {
+			return TrackInfo{}, fmt.Errorf("reading Ogg page: %w", err)
+		}
+		size := 0
+		for _, l := range lacing {
+			size += int(l)
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return TrackInfo{}, fmt.Errorf("reading Ogg page: %w", err)
+		}
+		// pages of other streams, as in videos, are none of our business.
+		if pageSerial != serial {
+			continue
+		}
+		// a packet ends with the first segment shorter than 255 bytes.
+		for _, l := range lacing {
+			packet = append(packet, body[:l]...)
+			body = body[l:]
+			if len(packet) > oggMaxCommentSize {
+				return TrackInfo{}, errors.New("Ogg comment packet too large")
+			}
+			if l == 255 {
+				continue
+			}
+			packets++
+			if packets == 2 {
+				return parseOggCommentPacket(packet)
+			}
+			packet = packet[:0]
+		}
+	}
+	return TrackInfo{}, errNoTags
+}
+
+// parseOggCommentPacket strips the codec's header from its comment packet.
+func parseOggCommentPacket(packet []byte) (TrackInfo, error) {
+	var comments []byte
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		comments = packet[7:]
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		comments = packet[8:]
+	default:
+		return TrackInfo{}, errNoTags
+	}
+	var info TrackInfo
+	if err := parseVorbisComments(comments, &info); err != nil {
+		return TrackInfo{}, err
+	}
+	if info.empty() {
+		return TrackInfo{}, errNoTags
+	}
+	return info, nil
+}
+
+// parseVorbisComments reads a vendor string and a list of NAME=value comments, all little endian length prefixed.
+// Names are case insensitive and may be repeated, the first value wins.
+func parseVorbisComments(data []byte, info *TrackInfo) error {
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		size := binary.LittleEndian.Uint32(data)
+		if uint64(size) > uint64(len(data)-4) {
+			return nil, false
+		}
+		field := data[4 : 4+size]
+		data = data[4+size:]
+		return field, true
+	}
+	if _, ok := next(); !ok {
+		return errors.New("broken Vorbis comments")
+	}
+	if len(data) < 4 {
+		return errors.New("broken Vorbis comments")
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	var comments TrackInfo
+	seen := make(map[string]bool)
+	for i := uint32(0); i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			// what came before is fine.
+			break
+		}
+		name, value, ok := strings.Cut(string(comment), "=")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(name)
+		if name == "metadata_block_picture" {
+			// pictures of Ogg files are FLAC picture blocks in base64.
+			if block, err := base64.StdEncoding.DecodeString(value); err == nil {
+				if picture, err := parseFLACPicture(block); err == nil {
+					comments.Pictures = append(comments.Pictures, picture)
+				}
+			}
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		comments.setField(name, value)
+	}
+	info.merge(comments)
+	return nil
+}
+
+// parseFLACPicture reads a FLAC picture block: its type, MIME type, description, dimensions, colors and the image,
+// numbers big endian.
+func parseFLACPicture(block []byte) (Picture, error) {
+	errBroken := errors.New("broken FLAC picture")
+	next := func() (uint32, bool) {
+		if len(block) < 4 {
+			return 0, false
+		}
+		n := binary.BigEndian.Uint32(block)
+		block = block[4:]
+		return n, true
+	}
+	field := func() ([]byte, bool) {
+		size, ok := next()
+		if !ok || uint64(size) > uint64(len(block)) {
+			return nil, false
+		}
+		b := block[:size]
+		block = block[size:]
+		return b, true
+	}
+	kind, ok := next()
+	if !ok {
+		return Picture{}, errBroken
+	}
+	mime, ok := field()
+	if !ok {
+		return Picture{}, errBroken
+	}
+	description, ok := field()
+	if !ok {
+		return Picture{}, errBroken
+	}
+	// width, height, depth and colors don't matter, the image says it all.
+	if len(block) < 16 {
+		return Picture{}, errBroken
+	}
+	block = block[16:]
+	data, ok := field()
+	if !ok || len(data) == 0 {
+		return Picture{}, errBroken
+	}
+	return Picture{
+		Type:        int(kind),
+		MIMEType:    string(mime),
+		Description: string(description),
+		Data:        data,
+	}, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// vorbisComments builds a comment block, as in FLAC files and after the header of Ogg comment packets.
+func vorbisComments(vendor string, comments ...string) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(vendor)))
+	b = append(b, vendor...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(comments)))
+	for _, comment := range comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(comment)))
+		b = append(b, comment...)
+	}
+	return b
+}
+
+func flacPictureBlock(kind int, mime, description string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(kind))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(mime)))
+	b = append(b, mime...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(description)))
+	b = append(b, description...)
+	// width, height, depth and colors.
+	b = append(b, make([]byte, 16)...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// flacFile builds the metadata of a FLAC file, the stream info block is added in front of blocks.
+func flacFile(blocks map[byte][]byte, kinds ...byte) []byte {
+	kinds = append([]byte{0}, kinds...)
+	blocks[0] = make([]byte, 34)
+	b := []byte("fLaC")
+	for i, kind := range kinds {
+		header := kind
+		if i == len(kinds)-1 {
+			header |= 0x80
+		}
+		size := len(blocks[kind])
+		b = append(b, header, byte(size>>16), byte(size>>8), byte(size))
+		b = append(b, blocks[kind]...)
+	}
+	return append(b, "audio frames"...)
+}
+
+// oggPage builds a page of the stream serial holding segments, its checksum is left empty as we don't check it.
+func oggPage(serial uint32, segments ...[]byte) []byte {
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint32(header[14:], serial)
+	header[26] = byte(len(segments))
+	var body []byte
+	for _, segment := range segments {
+		header = append(header, byte(len(segment)))
+		body = append(body, segment...)
+	}
+	return append(header, body...)
+}
+
+// oggSegments splits a packet into the segments of its lacing.
+func oggSegments(packet []byte) [][]byte {
+	var segments [][]byte
+	for len(packet) >= 255 {
+		segments = append(segments, packet[:255])
+		packet = packet[255:]
+	}
+	return append(segments, packet)
+}
+
+func TestReadVorbisCommentsFLAC(t *testing.T) {
+	cover := []byte("\x89PNG image")
+	comments := vorbisComments("reference libFLAC",
+		"TITLE=Title", "title=Other title", "Artist=Artist", "DATE=2001-02-03", "TRACKNUMBER=3/12",
+		"REPLAYGAIN_ALBUM_GAIN=+1.50 dB", "REPLAYGAIN_ALBUM_PEAK=0.5", "no separator")
+	file := flacFile(map[byte][]byte{
+		flacVorbisComment: comments,
+		flacPicture:       flacPictureBlock(pictureFrontCover, "image/png", "Cover", cover),
+		// padding
+		1: make([]byte, 100),
+	}, 1, flacVorbisComment, flacPicture)
+	want := TrackInfo{Title: "Title", Artist: "Artist", Year: "2001", Track: 3,
+		ReplayGain: ReplayGain{AlbumGain: 1.5, AlbumPeak: 0.5, HasAlbum: true},
+		Pictures:   []Picture{{Type: pictureFrontCover, MIMEType: "image/png", Description: "Cover", Data: cover}}}
+	// FLAC files can have an ID3v2 tag in front.
+	id3 := id3v2Tag(3, 0, id3Frame(3, "TIT2", []byte("\x00ID3 title")))
+	for name, data := range map[string][]byte{"plain": file, "after ID3v2": append(id3, file...)} {
+		info, err := readVorbisComments(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("%s: got %+v, want %+v", name, info, want)
+		}
+	}
+}
+
+func TestReadVorbisCommentsOgg(t *testing.T) {
+	cover := []byte("\xff\xd8 jpeg image")
+	picture := base64.StdEncoding.EncodeToString(flacPictureBlock(pictureFrontCover, "image/jpeg", "", cover))
+	tests := []struct {
+		name string
+		file []byte
+		info TrackInfo
+	}{
+		{
+			name: "Vorbis over pages",
+			file: func() []byte {
+				// the comment packet is long enough to go on in a second page, with one of another stream between.
+				packet := append([]byte("\x03vorbis"), vorbisComments("Xiph.Org libVorbis",
+					"TITLE=Title", "COMMENT="+string(bytes.Repeat([]byte("x"), 600)))...)
+				segments := oggSegments(packet)
+				var file []byte
+				file = append(file, oggPage(1, []byte("\x01vorbis identification"))...)
+				file = append(file, oggPage(1, segments[:2]...)...)
+				file = append(file, oggPage(2, []byte("video"))...)
+				file = append(file, oggPage(1, segments[2:]...)...)
+				return file
+			}(),
+			info: TrackInfo{Title: "Title", Comment: string(bytes.Repeat([]byte("x"), 600))},
+		},
+		{
+			name: "Opus",
+			file: append(oggPage(7, []byte("OpusHead")),
+				oggPage(7, append([]byte("OpusTags"), vorbisComments("libopus", "ARTIST=Artist",
+					"METADATA_BLOCK_PICTURE="+picture)...))...),
+			info: TrackInfo{Artist: "Artist",
+				Pictures: []Picture{{Type: pictureFrontCover, MIMEType: "image/jpeg", Data: cover}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := readVorbisComments(bytes.NewReader(test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(info, test.info) {
+				t.Errorf("got %+v, want %+v", info, test.info)
+			}
+		})
+	}
+}
+
+func TestReadVorbisCommentsNone(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":      nil,
+		"wave":       []byte("RIFF\x00\x00\x00\x00WAVEfmt "),
+		"no tags":    flacFile(map[byte][]byte{}),
+		"not Vorbis": append(oggPage(1, []byte("\x80theora")), oggPage(1, []byte("\x81theora"))...),
+	} {
+		if _, err := readVorbisComments(bytes.NewReader(data)); !errors.Is(err, errNoTags) {
+			t.Errorf("%s: got error %v, want %v", name, err, errNoTags)
+		}
+	}
+}
+
+// TestReadVorbisCommentsTruncated reads every prefix of tagged files, none should panic.
+func TestReadVorbisCommentsTruncated(t *testing.T) {
+	comments := vorbisComments("vendor", "TITLE=Title", "ARTIST=Artist")
+	picture := flacPictureBlock(pictureFrontCover, "image/png", "Cover", []byte("image"))
+	files := [][]byte{
+		flacFile(map[byte][]byte{flacVorbisComment: comments, flacPicture: picture}, flacVorbisComment, flacPicture),
+		append(oggPage(1, []byte("\x01vorbis")), oggPage(1, append([]byte("\x03vorbis"), comments...))...),
+	}
+	for _, file := range files {
+		for n := range file {
+			readVorbisComments(bytes.NewReader(file[:n]))
+		}
+	}
+	for n := range comments {
+		parseVorbisComments(comments[:n], &TrackInfo{})
+	}
+	for n := range picture {
+		if _, err := parseFLACPicture(picture[:n]); err == nil {
+			t.Errorf("picture truncated to %d bytes was read", n)
+		}
+	}
+}
@@ -17,6 +17,18 @@ import (
 type Background struct {
 	stack     *SpriteStack
 	textLayer *TextLayer
+	// overlays are drawn over the sprites but under the text.
+	overlays []layer
+	// size is the one of the window when it isn't the one of the first sprite's image.
+	size image.Point
+	// shape, if set, is the mask of the region of the window, nothing is drawn outside of it and the mouse is
+	// ignored there. fyne can't make windows see-through so what shows there is the background of the window.
+	shape *image.Alpha
+}
+
+// layer is something drawn over the sprites of a window, it returns nil where it has nothing to draw.
+type layer interface {
+	DrawAtPosition(x, y int) color.Color
 }
 
 func (b *Background) ColorModel() color.Model {
@@ -24,14 +36,39 @@ func (b *Background) ColorModel() color.Model {
 }
 
 func (b *Background) Bounds() image.Rectangle {
+	if b.size != (image.Point{}) {
+		return image.Rectangle{Max: b.size}
+	}
 	return b.stack.sprites[0].Bounds()
 }
 
+// setRegion shapes the window after region, nil leaves it rectangular.
+func (b *Background) setRegion(region *Region) {
+	b.shape = nil
+	if region != nil {
+		b.shape = region.Mask(b.Bounds())
+	}
+}
+
+// inside tells if x, y is part of the window.
+func (b *Background) inside(x, y int) bool {
+	return b.shape == nil || b.shape.AlphaAt(x, y).A != 0
+}
+
 func (b *Background) At(x, y int) color.Color {
+	if !b.inside(x, y) {
+		return color.Transparent
+	}
 	if colorAt := b.textLayer.DrawAtPosition(x, y); colorAt != nil {
 		return colorAt
 	}
 
+	for _, overlay := range b.overlays {
+		if colorAt := overlay.DrawAtPosition(x, y); colorAt != nil {
+			return colorAt
+		}
+	}
+
 	if colorAt := b.stack.DrawAtPosition(x, y); colorAt != nil {
 		return colorAt
 	}
@@ -46,12 +83,43 @@ type bgWidget struct {
 	x, y float32
 	w    fyne.Window
 	rdr  fyne.WidgetRenderer
+	// pressed, if set, gets mouse presses before the sprites, it reports whether it took them.
+	pressed func(x, y int, modifier fyne.KeyModifier) bool
+	// scrolled, if set, gets the mouse wheel.
+	scrolled func(dy float32)
+	// cursors, if set, are the ones of the skin for this window, hover is where the pointer is.
+	cursors *windowCursors
+	hover   image.Point
+}
+
+func (item *bgWidget) MouseIn(event *desktop.MouseEvent) {
+	item.MouseMoved(event)
+}
+
+func (item *bgWidget) MouseMoved(event *desktop.MouseEvent) {
+	item.hover = image.Pt(int(event.Position.X/scaleFactor), int(event.Position.Y/scaleFactor))
+}
+
+func (item *bgWidget) MouseOut() {}
+
+func (item *bgWidget) Cursor() desktop.Cursor {
+	if item.cursors == nil {
+		return desktop.DefaultCursor
+	}
+	return item.cursors.at(item.bg.stack, item.hover.X, item.hover.Y)
 }
 
 func (item *bgWidget) MouseDown(event *desktop.MouseEvent) {
 	x := int(event.Position.X / scaleFactor)
 	y := int(event.Position.Y / scaleFactor)
 	fmt.Printf("MouseDown: %d, %d\n", x, y)
+	if !item.bg.inside(x, y) {
+		return
+	}
+	if item.pressed != nil && item.pressed(x, y, event.Modifier) {
+		item.Refresh()
+		return
+	}
 	item.bg.stack.MouseDown(x, y)
 	item.ci.Refresh()
 	item.rdr.Refresh()
@@ -61,7 +129,11 @@ func (item *bgWidget) MouseUp(event *desktop.MouseEvent) {
 	x := int(event.Position.X / scaleFactor)
 	y := int(event.Position.Y / scaleFactor)
 	fmt.Printf("MouseUp: %d, %d\n", x, y)
-	item.bg.stack.DoAtPosition(x, y)
+	if item.bg.inside(x, y) {
+		item.bg.stack.DoAtPosition(x, y)
+	}
+	// a sprite pressed and released somewhere else, even off the shape of the window, has to look released too.
+	item.bg.stack.releasePressed()
 	item.ci.Refresh()
 	item.rdr.Refresh()
 }
@@ -76,8 +148,18 @@ func (item *bgWidget) DragEnd() {
 	item.bg.stack.DragEnd()
 }
 
+func (item *bgWidget) Scrolled(event *fyne.ScrollEvent) {
+	if item.scrolled != nil {
+		item.scrolled(event.Scrolled.DY)
+		item.Refresh()
+	}
+}
+
 var _ desktop.Mouseable = (*bgWidget)(nil)
 var _ fyne.Draggable = (*bgWidget)(nil)
+var _ fyne.Scrollable = (*bgWidget)(nil)
+var _ desktop.Hoverable = (*bgWidget)(nil)
+var _ desktop.Cursorable = (*bgWidget)(nil)
 
 func newBgWidget(rawImg *Background) *bgWidget {
 	img := canvas.NewImageFromImage(rawImg)
@@ -100,3 +182,10 @@ func (item *bgWidget) CreateRenderer() fyne.WidgetRenderer {
 	item.rdr = widget.NewSimpleRenderer(cnt)
 	return item.rdr
 }
+
+// showSpriteMenu pops a menu up under a button of the skin.
+func showSpriteMenu(w fyne.Window, button *AnimatedSprite, items ...*fyne.MenuItem) {
+	widget.ShowPopUpMenuAtPosition(fyne.NewMenu("", items...), w.Canvas(), fyne.NewPos(
+		float32(button.AbsolutePositionX*scaleFactor),
+		float32((button.AbsolutePositionY+button.Image.SpriteHeight)*scaleFactor)))
+}